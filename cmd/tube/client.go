@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/ivanvc/tube/internal/admin"
+)
+
+// The subcommands that talk to a running tube instance.
+var subcommands = map[string]func(c *admin.Client, args clientArgs) error{
+	"url":    printURL,
+	"reload": reloadCommand,
+	"status": printStatus,
+	"logs":   printLogs,
+}
+
+type clientArgs struct {
+	json   bool
+	lines  int
+	follow bool
+}
+
+// Runs the subcommand name, if it exists. Returns false otherwise.
+func runSubcommand(name string, arguments []string) bool {
+	run, ok := subcommands[name]
+	if !ok {
+		return false
+	}
+
+	var (
+		args             clientArgs
+		addr, token, dir string
+	)
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.BoolVar(&args.json, "json", false, "Print machine-readable JSON output.")
+	fs.StringVar(&addr, "admin-addr", os.Getenv("TUBE_ADMIN_ADDR"), "The admin API address of the instance, instead of locating it.")
+	fs.StringVar(&token, "admin-token", os.Getenv("TUBE_ADMIN_TOKEN"), "The admin API token, read from the instance's state by default.")
+	fs.StringVar(&dir, "dir", ".", "The project directory the instance is running in.")
+	if name == "logs" {
+		fs.IntVar(&args.lines, "lines", 100, "The number of lines to print.")
+		fs.BoolVar(&args.follow, "follow", false, "Keep printing new lines.")
+	}
+	fs.Parse(arguments)
+
+	// The instance might be started with the same variable.
+	if addr == "auto" {
+		addr = ""
+	}
+	if len(addr) == 0 {
+		state, err := admin.Locate(dir)
+		if err != nil {
+			log.Fatal("Error locating tube instance, is it running with -admin-addr?", "dir", dir, "error", err)
+		}
+		addr = state.AdminAddr
+		if len(token) == 0 {
+			token = state.Token
+		}
+	} else if len(token) == 0 {
+		// The instance listening on addr might be the one of the project.
+		if state, err := admin.Locate(dir); err == nil && state.AdminAddr == addr {
+			token = state.Token
+		}
+	}
+	if err := run(admin.NewClient(addr, token), args); err != nil {
+		log.Fatal("Error running "+name, "error", err)
+	}
+	return true
+}
+
+func printURL(c *admin.Client, args clientArgs) error {
+	url, err := c.URL()
+	if err != nil {
+		return err
+	}
+	if args.json {
+		return printJSON(map[string]string{"url": url})
+	}
+	fmt.Println(url)
+	return nil
+}
+
+func reloadCommand(c *admin.Client, args clientArgs) error {
+	if err := c.Do(admin.Action{Kind: admin.Reload}); err != nil {
+		return err
+	}
+	if args.json {
+		return printJSON(map[string]string{"status": "accepted"})
+	}
+	return nil
+}
+
+func printStatus(c *admin.Client, args clientArgs) error {
+	status, err := c.Status()
+	if err != nil {
+		return err
+	}
+	if args.json {
+		return printJSON(status)
+	}
+
+	p := status.Process
+	state := "not running"
+	switch {
+	case p.Running:
+		state = fmt.Sprintf("running (PID %d, up %s)", p.PID, p.Uptime)
+	case p.ExitCode != nil:
+		state = fmt.Sprintf("exited (code %d)", *p.ExitCode)
+	}
+	fmt.Printf("URL:      %s\n", strings.Join(status.URLs, ", "))
+	fmt.Printf("Uptime:   %s\n", status.Uptime)
+	fmt.Printf("Command:  %s\n", strings.Join(p.Command, " "))
+	fmt.Printf("State:    %s\n", state)
+	return nil
+}
+
+// Prints the last lines of the logs, if following, polls for new ones every
+// second.
+func printLogs(c *admin.Client, args clientArgs) error {
+	var last uint64
+	lines, err := c.Logs(args.lines, last)
+	for {
+		if err != nil {
+			return err
+		}
+		if len(lines) > 0 && last > 0 && lines[0].Seq > last+1 {
+			log.Warn("Some lines were discarded from the history before they were read", "count", lines[0].Seq-last-1)
+		}
+		for _, l := range lines {
+			last = l.Seq
+			if args.json {
+				if err := printJSON(l); err != nil {
+					return err
+				}
+				continue
+			}
+			fmt.Printf("%s [%s] %s\n", l.Time.Format(time.RFC3339), l.Stream, l.Message)
+		}
+		if !args.follow {
+			return nil
+		}
+		time.Sleep(time.Second)
+		lines, err = c.Logs(0, last)
+	}
+}
+
+func printJSON(v interface{}) error {
+	return json.NewEncoder(os.Stdout).Encode(v)
+}
@@ -2,18 +2,24 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"sort"
+	"strings"
 	"syscall"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/log"
+	"github.com/creack/pty"
 
+	"github.com/ivanvc/tube/internal/admin"
 	cmd "github.com/ivanvc/tube/internal/command"
 	"github.com/ivanvc/tube/internal/config"
 	intlog "github.com/ivanvc/tube/internal/log"
 	"github.com/ivanvc/tube/internal/server"
+	"github.com/ivanvc/tube/internal/tunnel"
 	"github.com/ivanvc/tube/internal/ui"
 )
 
@@ -24,36 +30,134 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "server" {
+		runServer(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && runSubcommand(os.Args[1], os.Args[2:]) {
+		return
+	}
+
 	cfg := config.Load()
 	if cfg.ShowVersion {
 		fmt.Printf("tube %s (%s) %s\n", version, commit, date)
 		return
 	}
 
-	if len(cfg.ListenPort) == 0 {
-		log.Fatal("Port needs to be specified, either by the TUBE_PORT environment variable, or by the first argument to the program")
+	if len(cfg.Static) > 0 {
+		if len(cfg.ListenPort) > 0 || len(cfg.ListenSocket) > 0 {
+			log.Fatal("Use either a port (or socket), or a static directory")
+		}
+		if info, err := os.Stat(cfg.Static); err != nil || !info.IsDir() {
+			log.Fatal("Static needs to be a directory", "static", cfg.Static)
+		}
+		if cfg.Mode == "tcp" {
+			log.Fatal("The static directory is served in the http mode")
+		}
+	} else if len(cfg.ListenPort) == 0 && len(cfg.ListenSocket) == 0 {
+		log.Fatal("Port needs to be specified, either by the TUBE_PORT environment variable, or by the first argument to the program, or a socket with -socket")
+	}
+
+	if !tunnel.ValidProvider(cfg.Provider) {
+		log.Fatal("Provider needs to be either localtunnel, ssh, or local", "provider", cfg.Provider)
+	}
+	if cfg.Provider == "ssh" && len(cfg.SSHHost) == 0 {
+		log.Fatal("The ssh provider needs a server, specify it with -ssh-host")
+	}
+	if cfg.Mode != "http" && cfg.Mode != "tcp" {
+		log.Fatal("Mode needs to be either http or tcp", "mode", cfg.Mode)
+	}
+	if cfg.Mode == "tcp" && cfg.Provider == "localtunnel" {
+		log.Fatal("The tcp mode needs the ssh or local provider, localtunnel only forwards HTTP")
+	}
+	if options := httpOptions(cfg); cfg.Mode == "tcp" && len(options) > 0 {
+		log.Fatal("The options need the http mode, the tcp mode pipes the connections", "options", strings.Join(options, ", "))
+	}
+	if cfg.H2C && cfg.ListenScheme != "http" {
+		log.Fatal("h2c needs the http scheme, HTTPS servers negotiate HTTP/2 already", "scheme", cfg.ListenScheme)
+	}
+	if err := server.ValidateUpstreamTLS(cfg); err != nil {
+		log.Fatal("Invalid upstream TLS options", "error", err)
+	}
+	if cfg.HostHeader != "preserve" && cfg.HostHeader != "local" {
+		log.Fatal("Host header needs to be either preserve or local", "host-header", cfg.HostHeader)
+	}
+	if err := server.ValidateHeaderRules(cfg.RequestHeaders); err != nil {
+		log.Fatal("Invalid request header", "error", err)
+	}
+	if err := server.ValidateHeaderRules(cfg.ResponseHeaders); err != nil {
+		log.Fatal("Invalid response header", "error", err)
+	}
+	if cfg.RateLimit < 0 || cfg.RateLimitBurst < 0 || cfg.MaxBodySize < 0 {
+		log.Fatal("Rate limit, its burst, and max body size can't be negative")
+	}
+	if len(cfg.Mocks) > 0 {
+		if err := server.ValidateMocks(cfg.Mocks); err != nil {
+			log.Fatal("Invalid mocks file", "error", err)
+		}
+	}
+	if err := server.ValidateFaults(cfg); err != nil {
+		log.Fatal("Invalid fault injection options", "error", err)
+	}
+	if cfg.MaxConnections < 1 {
+		log.Fatal("Max connections needs to be at least 1", "max-connections", cfg.MaxConnections)
+	}
+	if !intlog.ValidFormat(cfg.LogFormat) {
+		log.Fatal("Log format needs to be either text, json, or logfmt", "format", cfg.LogFormat)
+	}
+	if !intlog.ValidLevel(cfg.LogLevel) {
+		log.Fatal("Log level needs to be either debug, info, warn, or error", "level", cfg.LogLevel)
+	}
+	if f := cfg.AccessLogFormat; f != "styled" && f != "common" && f != "combined" {
+		log.Fatal("Access log format needs to be either styled, common, or combined", "format", f)
+	}
+	if cfg.LogFileFormat != "text" && cfg.LogFileFormat != "json" {
+		log.Fatal("Log file format needs to be either text or json", "format", cfg.LogFileFormat)
+	}
+
+	var logFile *intlog.File
+	if len(cfg.LogFile) > 0 {
+		var err error
+		if logFile, err = intlog.NewFile(cfg); err != nil {
+			log.Fatal("error opening log file", "error", err)
+		}
+		defer logFile.Close()
 	}
 
 	if cfg.StandaloneMode {
-		startStandalone(cfg)
+		startStandalone(cfg, logFile)
 	} else {
-		startTUI(cfg)
+		startTUI(cfg, logFile)
 	}
 }
 
-func startStandalone(cfg *config.Config) {
-	logger := intlog.NewStdout()
+func startStandalone(cfg *config.Config, logFile *intlog.File) {
+	logger := intlog.NewStdout(cfg)
+	recentLogs := intlog.NewRing(cfg.MaxLines)
+	sinks := intlog.MultiSink{recentLogs}
+	if logFile != nil {
+		sinks = append(sinks, logFile)
+	}
+	logger.Tee(sinks.Writer("tube"))
+	stdout := io.MultiWriter(os.Stdout, sinks.Writer(string(cmd.Stdout)))
+	stderr := io.MultiWriter(os.Stderr, sinks.Writer(string(cmd.Stderr)))
 	if len(cfg.ExecCommand) > 0 {
 		logger.SetPrefix("TUBE")
 		log.TimestampStyle = log.TimestampStyle.Foreground(lipgloss.Color("3"))
 		log.PrefixStyle = log.PrefixStyle.Foreground(lipgloss.Color("3"))
 		log.SeparatorStyle = log.SeparatorStyle.Foreground(lipgloss.Color("11"))
 	}
-	server := server.New(cfg, logger)
-	mgr := cmd.NewManager(logger, os.Stdout)
+	server := server.New(cfg, logger, logger)
+	mgr := cmd.NewManager(cfg, logger, stdout, stderr)
+	if rows, cols, err := pty.Getsize(os.Stdout); err == nil {
+		mgr.SetSize(cols, rows)
+	}
 	watcher := cmd.NewWatcher(cfg, logger)
+	api := admin.New(cfg, logger, server, mgr, recentLogs)
 	defer mgr.Stop()
 	defer watcher.Close()
+	defer api.Close()
+	defer server.Close()
 
 	if _, err := server.StartListener(); err != nil {
 		logger.Fatal("error initializing listener", "error", err)
@@ -63,12 +167,20 @@ func startStandalone(cfg *config.Config) {
 			logger.Fatal("error initializing http server", "error", err)
 		}
 	}()
+	if err := api.Listen(); err != nil {
+		logger.Fatal("error initializing admin API", "error", err)
+	}
+	go func() {
+		if err := api.Serve(); err != nil {
+			logger.Error("error serving admin API", "error", err)
+		}
+	}()
 
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-	printTunnel := make(chan os.Signal)
+	printTunnel := make(chan os.Signal, 1)
 	signal.Notify(printTunnel, syscall.SIGUSR1, syscall.SIGUSR2)
-	reload := make(chan os.Signal)
+	reload := make(chan os.Signal, 1)
 	signal.Notify(reload, syscall.SIGHUP)
 
 	go mgr.Run(cfg.ExecCommand)
@@ -77,11 +189,32 @@ func startStandalone(cfg *config.Config) {
 	for {
 		select {
 		case <-watcher.Activity():
+			// The static directory is watched instead, and the command
+			// likely writes to it, so only the browsers are reloaded.
+			if len(cfg.Static) > 0 {
+				server.LiveReload()
+				continue
+			}
 			mgr.Stop()
 			go mgr.Run(cfg.ExecCommand)
 		case <-reload:
 			mgr.Stop()
 			go mgr.Run(cfg.ExecCommand)
+		case action := <-api.Actions():
+			switch action.Kind {
+			case admin.Stop:
+				mgr.Stop()
+			case admin.Start:
+				if !mgr.Status().Running {
+					go mgr.Run(cfg.ExecCommand)
+				}
+			case admin.SetCommand:
+				cfg.ExecCommand = action.Command
+				fallthrough
+			case admin.Reload:
+				mgr.Stop()
+				go mgr.Run(cfg.ExecCommand)
+			}
 		case <-printTunnel:
 			log.Infof("Tunnel available at: %s", server.ListenerAddr())
 		case <-done:
@@ -90,9 +223,39 @@ func startStandalone(cfg *config.Config) {
 	}
 }
 
-func startTUI(cfg *config.Config) {
-	p := tea.NewProgram(ui.New(cfg), tea.WithAltScreen())
+func startTUI(cfg *config.Config, logFile *intlog.File) {
+	model, err := ui.New(cfg, logFile)
+	if err != nil {
+		log.Fatal("error initializing admin API", "error", err)
+	}
+	p := tea.NewProgram(model, tea.WithAltScreen(), tea.WithMouseCellMotion())
 	if _, err := p.Run(); err != nil {
 		log.Fatal(err)
 	}
 }
+
+// Returns the options that are set, and only apply to the http mode.
+func httpOptions(cfg *config.Config) []string {
+	var options []string
+	for name, set := range map[string]bool{
+		"-mocks":                len(cfg.Mocks) > 0,
+		"-rate-limit":           cfg.RateLimit > 0,
+		"-rate-limit-burst":     cfg.RateLimitBurst > 0,
+		"-max-body-size":        cfg.MaxBodySize > 0,
+		"-request-header":       len(cfg.RequestHeaders) > 0,
+		"-response-header":      len(cfg.ResponseHeaders) > 0,
+		"-host-header":          cfg.HostHeader != "preserve",
+		"-h2c":                  cfg.H2C,
+		"-upstream-insecure":    cfg.UpstreamInsecure,
+		"-upstream-ca":          len(cfg.UpstreamCA) > 0,
+		"-upstream-server-name": len(cfg.UpstreamServerName) > 0,
+		"-upstream-cert":        len(cfg.UpstreamCert) > 0,
+		"-upstream-key":         len(cfg.UpstreamKey) > 0,
+	} {
+		if set {
+			options = append(options, name)
+		}
+	}
+	sort.Strings(options)
+	return options
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/ivanvc/tube/internal/config"
+	intlog "github.com/ivanvc/tube/internal/log"
+	"github.com/ivanvc/tube/internal/ltserver"
+)
+
+// Runs a localtunnel-compatible server, to self-host the tunnels.
+func runServer(arguments []string) {
+	var (
+		opts ltserver.Options
+		cfg  config.Config
+	)
+	fs := flag.NewFlagSet("server", flag.ExitOnError)
+	fs.StringVar(&opts.Addr, "addr", ":8080", "The address to listen on for HTTP requests.")
+	fs.StringVar(&opts.Domain, "domain", "", "The domain the tunnels are subdomains of, defaults to the Host of the requests.")
+	fs.BoolVar(&opts.Secure, "secure", false, "Use https in the tunnel URLs, when a proxy in front terminates TLS.")
+	fs.IntVar(&opts.MaxSockets, "max-sockets", 10, "The maximum number of sockets per tunnel.")
+	fs.StringVar(&cfg.LogFormat, "log-format", "text", "The format of the logs, either text, json, or logfmt.")
+	fs.StringVar(&cfg.LogLevel, "log-level", "info", "The minimum level of the logs, either debug, info, warn, or error.")
+	fs.Parse(arguments)
+
+	if !intlog.ValidFormat(cfg.LogFormat) {
+		log.Fatal("Log format needs to be either text, json, or logfmt", "format", cfg.LogFormat)
+	}
+	if !intlog.ValidLevel(cfg.LogLevel) {
+		log.Fatal("Log level needs to be either debug, info, warn, or error", "level", cfg.LogLevel)
+	}
+	if opts.MaxSockets < 1 {
+		log.Fatal("Max sockets needs to be at least 1", "max-sockets", opts.MaxSockets)
+	}
+
+	logger := intlog.NewStdout(&cfg)
+	srv := ltserver.New(opts, logger)
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-done
+		srv.Close()
+	}()
+	if err := srv.ListenAndServe(); err != nil {
+		logger.Fatal("error running server", "error", err)
+	}
+}
@@ -0,0 +1,415 @@
+package admin
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	cmd "github.com/ivanvc/tube/internal/command"
+	"github.com/ivanvc/tube/internal/config"
+	"github.com/ivanvc/tube/internal/log"
+	"github.com/ivanvc/tube/internal/server"
+)
+
+const defaultLogLines = 100
+
+// The admin address to listen on a unix socket for the project.
+const autoAddr = "auto"
+
+// ActionKind is the kind of an action requested through the API.
+type ActionKind string
+
+const (
+	Reload     ActionKind = "reload"
+	Stop       ActionKind = "stop"
+	Start      ActionKind = "start"
+	SetCommand ActionKind = "command"
+)
+
+// Action is a request to control the command, to be handled by the mode
+// tube is running in.
+type Action struct {
+	Kind    ActionKind
+	Command []string
+}
+
+// Server is the local control and status HTTP API.
+type Server struct {
+	cfg      *config.Config
+	logger   log.Logger
+	tunnel   *server.Server
+	manager  *cmd.Manager
+	logs     *log.Ring
+	server   *http.Server
+	listener net.Listener
+	addr     string
+	token    string
+	// Whether it listens on TCP, where the Host header is checked.
+	tcp     bool
+	dir     string
+	actions chan Action
+	start   time.Time
+	// Why it's not listening with auto, logged once it serves.
+	unavailable error
+}
+
+// StatusResponse is the response of the status endpoint.
+type StatusResponse struct {
+	URLs    []string      `json:"urls"`
+	Uptime  string        `json:"uptime"`
+	Process ProcessStatus `json:"process"`
+}
+
+// ProcessStatus is the state of the command.
+type ProcessStatus struct {
+	Command   []string   `json:"command"`
+	Running   bool       `json:"running"`
+	PID       int        `json:"pid,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	Uptime    string     `json:"uptime,omitempty"`
+	ExitCode  *int       `json:"exit_code,omitempty"`
+}
+
+// LogLine is a line of the session logs.
+type LogLine struct {
+	Seq     uint64    `json:"seq"`
+	Time    time.Time `json:"time"`
+	Stream  string    `json:"stream"`
+	Message string    `json:"message"`
+}
+
+type commandRequest struct {
+	Command []string `json:"command"`
+}
+
+// Returns a new admin Server, exposing the tunnel, the command, and the
+// recent logs.
+func New(cfg *config.Config, logger log.Logger, tunnel *server.Server, manager *cmd.Manager, logs *log.Ring) *Server {
+	s := &Server{
+		cfg:     cfg,
+		logger:  logger,
+		tunnel:  tunnel,
+		manager: manager,
+		logs:    logs,
+		actions: make(chan Action),
+		start:   time.Now(),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/url", s.handleURL)
+	mux.HandleFunc("/logs", s.handleLogs)
+	mux.HandleFunc("/reload", s.handleAction(Reload))
+	mux.HandleFunc("/stop", s.handleAction(Stop))
+	mux.HandleFunc("/start", s.handleAction(Start))
+	mux.HandleFunc("/command", s.handleCommand)
+	s.server = &http.Server{
+		Handler:  s.authorize(mux),
+		ErrorLog: logger.GetStandardLogWithErrorLevel(),
+	}
+	return s
+}
+
+// Starts listening on the admin address, if it's set: either a unix socket
+// prefixed by unix:, or a loopback TCP address. With auto, it listens on a
+// unix socket for the project in the current directory, and if it fails, it
+// only warns once it serves. Then, writes the state file with the token, so
+// clients can locate the API. It doesn't log, as the logs might not be read
+// until it serves.
+func (s *Server) Listen() error {
+	if len(s.cfg.AdminAddr) == 0 {
+		return nil
+	}
+	err := s.listen()
+	if err != nil && s.listener != nil {
+		s.listener.Close()
+		s.listener = nil
+	}
+	if err != nil && s.cfg.AdminAddr == autoAddr {
+		s.unavailable = err
+		return nil
+	}
+	return err
+}
+
+func (s *Server) listen() error {
+	var err error
+	if s.dir, err = os.Getwd(); err != nil {
+		return err
+	}
+	if s.token = s.cfg.AdminToken; len(s.token) == 0 {
+		if s.token, err = randomToken(); err != nil {
+			return err
+		}
+	}
+	s.addr = s.cfg.AdminAddr
+	if s.addr == autoAddr {
+		s.addr = defaultAddr(s.dir)
+		if err := ensureStateDir(); err != nil {
+			return err
+		}
+	}
+	network, address := "tcp", s.addr
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		network, address = "unix", path
+		if err := removeStaleSocket(address); err != nil {
+			return err
+		}
+	} else if err := checkLoopback(address); err != nil {
+		return err
+	}
+	s.tcp = network == "tcp"
+	if s.listener, err = net.Listen(network, address); err != nil {
+		if s.cfg.AdminAddr == autoAddr {
+			// Another instance is probably running for the same project.
+			return fmt.Errorf("another instance is running in this directory: %w", err)
+		}
+		return err
+	}
+	return writeState(State{
+		PID:       os.Getpid(),
+		Dir:       s.dir,
+		AdminAddr: s.addr,
+		Token:     s.token,
+		StartedAt: s.start,
+	})
+}
+
+// Serves the API, if listening.
+func (s *Server) Serve() error {
+	if s.unavailable != nil {
+		s.logger.Log().Warn("Admin API not available", "error", s.unavailable)
+	}
+	if s.listener == nil {
+		return nil
+	}
+	s.logger.Log().Infof("Admin API listening on %s", s.addr)
+	if err := s.server.Serve(s.listener); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Terminates the API server, and removes the state file.
+func (s *Server) Close() error {
+	if s.listener != nil {
+		removeState(s.dir)
+	}
+	return s.server.Close()
+}
+
+// Returns the Actions channel.
+func (s *Server) Actions() <-chan Action {
+	return s.actions
+}
+
+// Rejects the requests without the token, the ones with a Host that is not
+// a loopback name over TCP (i.e., DNS rebinding), and the POST requests that
+// are not JSON, as browsers send those without a preflight.
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.tcp && !isLoopbackHost(r.Host) {
+			writeError(w, http.StatusForbidden, "host not allowed")
+			return
+		}
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "invalid or missing token")
+			return
+		}
+		if r.Method == http.MethodPost {
+			if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+				writeError(w, http.StatusUnsupportedMediaType, "content type needs to be application/json")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	status := s.manager.Status()
+	process := ProcessStatus{Command: status.Command, Running: status.Running}
+	if len(process.Command) == 0 {
+		process.Command = s.cfg.ExecCommand
+	}
+	if !status.StartedAt.IsZero() {
+		process.StartedAt = &status.StartedAt
+	}
+	if status.Running {
+		process.PID = status.PID
+		process.Uptime = time.Since(status.StartedAt).Round(time.Second).String()
+	} else if !status.ExitedAt.IsZero() {
+		process.ExitCode = &status.ExitCode
+	}
+	writeJSON(w, http.StatusOK, StatusResponse{
+		URLs:    s.urls(),
+		Uptime:  time.Since(s.start).Round(time.Second).String(),
+		Process: process,
+	})
+}
+
+func (s *Server) handleURL(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	urls := s.urls()
+	if len(urls) == 0 {
+		writeError(w, http.StatusServiceUnavailable, "tunnel not established")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"url": urls[0]})
+}
+
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	query := r.URL.Query()
+	var since uint64
+	if v := query.Get("since"); len(v) > 0 {
+		var err error
+		if since, err = strconv.ParseUint(v, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, "since needs to be the seq of a line")
+			return
+		}
+	}
+	// After a line, all of the following ones are returned by default.
+	n := defaultLogLines
+	if query.Has("since") {
+		n = 0
+	}
+	if v := query.Get("lines"); len(v) > 0 {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "lines needs to be a number, 0 for all of them")
+			return
+		}
+	}
+	logs := s.logs.Lines(n, since)
+	lines := make([]LogLine, 0, len(logs))
+	for _, l := range logs {
+		lines = append(lines, LogLine(l))
+	}
+	writeJSON(w, http.StatusOK, map[string][]LogLine{"lines": lines})
+}
+
+func (s *Server) handleAction(kind ActionKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+		s.dispatch(w, r.Context(), Action{Kind: kind})
+	}
+}
+
+func (s *Server) handleCommand(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	var req commandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Command) == 0 {
+		writeError(w, http.StatusBadRequest, `body needs to be {"command": ["program", "args..."]}`)
+		return
+	}
+	s.dispatch(w, r.Context(), Action{Kind: SetCommand, Command: req.Command})
+}
+
+func (s *Server) dispatch(w http.ResponseWriter, ctx context.Context, action Action) {
+	select {
+	case s.actions <- action:
+		s.logger.Log().Info("Admin API action requested", "action", action.Kind)
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "accepted"})
+	case <-ctx.Done():
+	}
+}
+
+func (s *Server) urls() []string {
+	urls := []string{}
+	if addr := s.tunnel.ListenerAddr(); len(addr) > 0 {
+		urls = append(urls, addr)
+	}
+	return urls
+}
+
+// Returns an error if the TCP address is not a loopback one, as the API
+// runs commands.
+func checkLoopback(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if !isLoopbackHost(host) {
+		return fmt.Errorf("admin address %s needs to be a loopback address, i.e., 127.0.0.1:4040", address)
+	}
+	return nil
+}
+
+// Returns true if host (with or without port) is localhost, or a loopback
+// IP.
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Removes the socket left by a previous run, if nothing is listening on it.
+// Anything else than a socket is never removed.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists, and it's not a socket", path)
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil
+	}
+	return os.Remove(path)
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
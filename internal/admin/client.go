@@ -0,0 +1,114 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client talks to the admin API of a running tube instance.
+type Client struct {
+	http    *http.Client
+	baseURL string
+	token   string
+}
+
+// Returns a new Client for the API listening on addr, either a unix socket
+// prefixed by unix:, or a TCP address, authenticating with the token.
+func NewClient(addr, token string) *Client {
+	c := &Client{http: &http.Client{Timeout: 10 * time.Second}, token: token}
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		c.baseURL = "http://localhost"
+		c.http.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		}
+	} else {
+		c.baseURL = "http://" + addr
+	}
+	return c
+}
+
+// Returns the public URL of the tunnel.
+func (c *Client) URL() (string, error) {
+	var res struct {
+		URL string `json:"url"`
+	}
+	err := c.do(http.MethodGet, "/url", nil, &res)
+	return res.URL, err
+}
+
+// Returns the status of the tunnel and the command.
+func (c *Client) Status() (*StatusResponse, error) {
+	res := new(StatusResponse)
+	if err := c.do(http.MethodGet, "/status", nil, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Returns up to the last n lines of the session logs (all of them if n is 0)
+// written after the line numbered since.
+func (c *Client) Logs(n int, since uint64) ([]LogLine, error) {
+	var res struct {
+		Lines []LogLine `json:"lines"`
+	}
+	err := c.do(http.MethodGet, fmt.Sprintf("/logs?lines=%d&since=%d", n, since), nil, &res)
+	return res.Lines, err
+}
+
+// Requests an action to control the command.
+func (c *Client) Do(action Action) error {
+	var body interface{}
+	if action.Kind == SetCommand {
+		body = commandRequest{Command: action.Command}
+	}
+	return c.do(http.MethodPost, "/"+string(action.Kind), body, nil)
+}
+
+func (c *Client) do(method, path string, body, v interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, c.baseURL+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		var e struct {
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&e); err != nil || len(e.Error) == 0 {
+			return fmt.Errorf("unexpected response: %s", res.Status)
+		}
+		return errors.New(e.Error)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
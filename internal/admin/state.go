@@ -0,0 +1,143 @@
+package admin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// ErrNotRunning is returned when there's no tube instance running for a
+// project.
+var ErrNotRunning = errors.New("no running tube instance found")
+
+// State describes a running tube instance, it's written to a per-project
+// state file, so clients can locate the instance's API.
+type State struct {
+	PID       int       `json:"pid"`
+	Dir       string    `json:"dir"`
+	AdminAddr string    `json:"admin_addr"`
+	Token     string    `json:"token"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// Returns the directory holding the state files and sockets of the current
+// user.
+func stateDir() string {
+	if dir, ok := os.LookupEnv("XDG_RUNTIME_DIR"); ok && len(dir) > 0 {
+		return filepath.Join(dir, "tube")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("tube-%d", os.Getuid()))
+}
+
+// Creates the state directory, and checks that it's only accessible by the
+// current user, as it might be in a shared temporary directory.
+func ensureStateDir() error {
+	dir := stateDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	return checkStateDir(dir)
+}
+
+// Returns an error if dir is not a directory owned by the current user, with
+// 0700 permissions.
+func checkStateDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("state directory %s is not a directory", dir)
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); !ok || int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("state directory %s is not owned by the current user", dir)
+	}
+	if info.Mode().Perm() != 0o700 {
+		return fmt.Errorf("state directory %s needs 0700 permissions, it has %#o", dir, info.Mode().Perm())
+	}
+	return nil
+}
+
+// Returns the path of the file for the project in dir, with the extension.
+func statePath(dir, ext string) string {
+	sum := sha256.Sum256([]byte(dir))
+	return filepath.Join(stateDir(), hex.EncodeToString(sum[:8])+ext)
+}
+
+// Returns the default API address for the project in dir, a unix socket in
+// the state directory.
+func defaultAddr(dir string) string {
+	return "unix:" + statePath(dir, ".sock")
+}
+
+// Writes the state file, replacing it atomically.
+func writeState(s State) error {
+	if err := ensureStateDir(); err != nil {
+		return err
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	path := statePath(s.Dir, ".json")
+	tmp := fmt.Sprintf("%s.%d.tmp", path, s.PID)
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Removes the state file of the project in dir, if it was written by this
+// process.
+func removeState(dir string) {
+	if s, err := readState(dir); err == nil && s.PID == os.Getpid() {
+		os.Remove(statePath(dir, ".json"))
+	}
+}
+
+func readState(dir string) (*State, error) {
+	b, err := os.ReadFile(statePath(dir, ".json"))
+	if err != nil {
+		return nil, err
+	}
+	s := new(State)
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Locates the tube instance running for the project in dir, or any of its
+// parent directories.
+func Locate(dir string) (*State, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStateDir(stateDir()); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotRunning
+		}
+		return nil, err
+	}
+	for {
+		if s, err := readState(dir); err == nil {
+			// Signal 0 only checks that the process exists.
+			if syscall.Kill(s.PID, 0) == nil {
+				return s, nil
+			}
+			os.Remove(statePath(dir, ".json"))
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, ErrNotRunning
+		}
+		dir = parent
+	}
+}
@@ -2,24 +2,57 @@ package command
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
+	"sync"
 	"syscall"
+	"time"
 
+	"github.com/creack/pty"
+
+	"github.com/ivanvc/tube/internal/config"
 	"github.com/ivanvc/tube/internal/log"
 )
 
+// Stream is the name of an output stream of the command.
+type Stream string
+
+const (
+	Stdout Stream = "stdout"
+	Stderr Stream = "stderr"
+)
+
+// Status holds the state of the command.
+type Status struct {
+	Command   []string
+	Running   bool
+	PID       int
+	StartedAt time.Time
+	ExitedAt  time.Time
+	ExitCode  int
+}
+
 // Manager has the running program initialized by the tunnel.
 type Manager struct {
 	*exec.Cmd
+	cfg    *config.Config
 	logger log.Logger
-	output io.Writer
+	stdout io.Writer
+	stderr io.Writer
+
+	mu     sync.Mutex
+	pty    *os.File
+	size   *pty.Winsize
+	status Status
 }
 
-// Returns a new command manager.
-func NewManager(logger log.Logger, output io.Writer) *Manager {
-	return &Manager{logger: logger, output: output}
+// Returns a new command manager, the output of the command is written to
+// stdout and stderr respectively.
+func NewManager(cfg *config.Config, logger log.Logger, stdout, stderr io.Writer) *Manager {
+	return &Manager{cfg: cfg, logger: logger, stdout: stdout, stderr: stderr}
 }
 
 // Runs the command.
@@ -29,22 +62,36 @@ func (m *Manager) Run(command []string) error {
 	}
 	m.logger.Log().Info("Starting new process", "command", command[0], "args", command[1:])
 
-	m.Cmd = exec.Command(command[0], command[1:]...)
-	m.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	c := exec.Command(command[0], command[1:]...)
+	if m.cfg.UsePTY {
+		return m.runWithPTY(c, command)
+	}
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 
-	stdout, err := m.StdoutPipe()
+	stdout, err := c.StdoutPipe()
 	if err != nil {
 		return err
 	}
-	go pipeOutput("stdout", stdout, m.logger, m.output)
+	go pipeOutput(Stdout, stdout, m.logger, m.stdout)
 
-	stderr, err := m.StderrPipe()
+	stderr, err := c.StderrPipe()
 	if err != nil {
 		return err
 	}
-	go pipeOutput("stderr", stderr, m.logger, m.output)
+	go pipeOutput(Stderr, stderr, m.logger, m.stderr)
 
-	if err := m.Cmd.Run(); err != nil {
+	// The command and its status are set while holding the lock, so Stop
+	// either sees it running, or waits until it started.
+	m.mu.Lock()
+	if err := c.Start(); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	m.started(c, command)
+	m.mu.Unlock()
+	err = c.Wait()
+	m.exited(c)
+	if err != nil {
 		return err
 	}
 	m.logger.Log().Info("Process exited", "command", command[0])
@@ -52,19 +99,42 @@ func (m *Manager) Run(command []string) error {
 	return nil
 }
 
+// Returns the status of the command.
+func (m *Manager) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+// Sets the size of the pseudo-terminal, used when the command runs in one.
+func (m *Manager) SetSize(cols, rows int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.size = &pty.Winsize{Cols: uint16(cols), Rows: uint16(rows)}
+	if m.pty != nil {
+		if err := pty.Setsize(m.pty, m.size); err != nil {
+			m.logger.Log().Error("Error resizing pseudo-terminal", "error", err)
+		}
+	}
+}
+
 // Stops the process, wait for it to stop.
 func (m *Manager) Stop() error {
-	if m.Cmd == nil {
+	m.mu.Lock()
+	c, running := m.Cmd, m.status.Running
+	m.mu.Unlock()
+	if c == nil || !running {
 		return nil
 	}
 
-	if err := syscall.Kill(-m.Process.Pid, syscall.SIGKILL); err != nil {
-		m.logger.Log().Error("Error trying to stop command", "command", m.Args[0], "error", err)
+	if err := syscall.Kill(-c.Process.Pid, syscall.SIGKILL); err != nil {
+		m.logger.Log().Error("Error trying to stop command", "command", c.Args[0], "error", err)
 		return err
 	}
-	_, err := m.Process.Wait()
+	_, err := c.Process.Wait()
 	if err != nil {
-		m.logger.Log().Error("Error trying to stop command", "command", m.Args[0], "error", err)
+		m.logger.Log().Error("Error trying to stop command", "command", c.Args[0], "error", err)
 		return err
 	}
 	return nil
@@ -72,28 +142,113 @@ func (m *Manager) Stop() error {
 
 // Kills the process.
 func (m *Manager) Kill() error {
-	if m.Cmd == nil || !m.ProcessState.Exited() {
+	m.mu.Lock()
+	c := m.Cmd
+	m.mu.Unlock()
+	if c == nil || !c.ProcessState.Exited() {
 		return nil
 	}
 
-	if err := m.Process.Kill(); err != nil {
-		m.logger.Log().Error("Error killing command", "command", m.Args[0], "error", err)
+	if err := c.Process.Kill(); err != nil {
+		m.logger.Log().Error("Error killing command", "command", c.Args[0], "error", err)
+		return err
+	}
+	return nil
+}
+
+// ReadLine reads until the first line feed or carriage return, returning the
+// line including the delimiter.
+func ReadLine(r *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return line, err
+		}
+		line = append(line, b)
+		if b == '\r' && r.Buffered() > 0 {
+			if next, _ := r.Peek(1); next[0] == '\n' {
+				continue
+			}
+		}
+		if b == '\n' || b == '\r' {
+			return line, nil
+		}
+	}
+}
+
+// Runs the command in a new session with a pseudo-terminal, so the command
+// keeps its colors. Both stdout and stderr are written to stdout.
+func (m *Manager) runWithPTY(c *exec.Cmd, command []string) error {
+	m.mu.Lock()
+	f, err := pty.StartWithSize(c, m.size)
+	if err != nil {
+		m.mu.Unlock()
 		return err
 	}
+	m.pty = f
+	m.started(c, command)
+	m.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		pipeOutput(Stdout, f, m.logger, m.stdout)
+		close(done)
+	}()
+
+	err = c.Wait()
+	m.exited(c)
+	<-done
+	m.mu.Lock()
+	m.pty = nil
+	m.mu.Unlock()
+	f.Close()
+	if err != nil {
+		return err
+	}
+	m.logger.Log().Info("Process exited", "command", command[0])
+
 	return nil
 }
 
-func pipeOutput(t string, r io.ReadCloser, logger log.Logger, output io.Writer) {
+// Sets the running command, and its status. It needs to hold the lock.
+func (m *Manager) started(c *exec.Cmd, command []string) {
+	m.Cmd = c
+	m.status = Status{
+		Command:   command,
+		Running:   true,
+		PID:       c.Process.Pid,
+		StartedAt: time.Now(),
+	}
+}
+
+// Sets the status of the command as exited, unless it was replaced by a newer
+// one.
+func (m *Manager) exited(c *exec.Cmd) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Cmd != c {
+		return
+	}
+	m.status.Running = false
+	m.status.ExitedAt = time.Now()
+	m.status.ExitCode = c.ProcessState.ExitCode()
+}
+
+func pipeOutput(t Stream, r io.Reader, logger log.Logger, output io.Writer) {
 	reader := bufio.NewReader(r)
 	for {
-		line, err := reader.ReadSlice('\n')
-		if err == io.EOF {
+		line, err := ReadLine(reader)
+		if len(line) > 0 {
+			output.Write(line)
+		}
+		// Reading from a pseudo-terminal fails with EIO once the command exits.
+		if err == io.EOF || errors.Is(err, syscall.EIO) {
 			return
 		}
 		if err != nil {
-			logger.Log().Error("Error reading "+t, "error", err)
+			logger.Log().Error("Error reading "+string(t), "error", err)
 			return
 		}
-		output.Write(line)
 	}
 }
@@ -1,6 +1,9 @@
 package command
 
 import (
+	"io/fs"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -14,6 +17,8 @@ type Watcher struct {
 	*fsnotify.Watcher
 	logger   log.Logger
 	activity chan *fsnotify.Event
+	// The static directory, watched recursively instead of the current one.
+	static string
 }
 
 const timeout = 250 * time.Millisecond
@@ -32,6 +37,7 @@ func NewWatcher(cfg *config.Config, logger log.Logger) *Watcher {
 		Watcher:  w,
 		logger:   logger,
 		activity: make(chan *fsnotify.Event),
+		static:   cfg.Static,
 	}
 }
 
@@ -41,13 +47,19 @@ func (w *Watcher) Run() {
 		return
 	}
 
-	if err := w.Add("."); err != nil {
+	if len(w.static) > 0 {
+		w.addTree(w.static)
+	} else if err := w.Add("."); err != nil {
 		w.logger.Log().Error("Error adding watch for current directory", "error", err)
 	}
 
 	stream := make(chan *fsnotify.Event)
 	go debounce(timeout, stream, func(event *fsnotify.Event) {
-		w.logger.Log().Infof("%s modified, reloading command", event.Name)
+		if len(w.static) > 0 {
+			w.logger.Log().Infof("%s modified, reloading browsers", event.Name)
+		} else {
+			w.logger.Log().Infof("%s modified, reloading command", event.Name)
+		}
 		w.activity <- event
 	})
 
@@ -57,6 +69,11 @@ func (w *Watcher) Run() {
 			if !ok {
 				return
 			}
+			if len(w.static) > 0 && event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					w.addTree(event.Name)
+				}
+			}
 			stream <- &event
 		case err, ok := <-w.Errors:
 			if !ok {
@@ -67,6 +84,19 @@ func (w *Watcher) Run() {
 	}
 }
 
+// Watches the directory and its subdirectories.
+func (w *Watcher) addTree(dir string) {
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		return w.Add(path)
+	})
+	if err != nil {
+		w.logger.Log().Error("Error adding watch for static directory", "error", err)
+	}
+}
+
 // Closes the underlying fsnotify.Watcher, if initialized.
 func (w *Watcher) Close() error {
 	if w.Watcher != nil {
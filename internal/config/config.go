@@ -6,6 +6,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const envVarPrefix = "TUBE"
@@ -15,14 +16,69 @@ type Config struct {
 	ListenHost   string
 	ListenPort   string
 	ListenScheme string
+	ListenSocket string
+	Mode         string
+	H2C          bool
 
-	ServerBaseURL string
+	Static        string
+	StaticListing bool
+	StaticSPA     bool
+
+	UpstreamInsecure   bool
+	UpstreamCA         string
+	UpstreamServerName string
+	UpstreamCert       string
+	UpstreamKey        string
+
+	HostHeader      string
+	RequestHeaders  []string
+	ResponseHeaders []string
+
+	RateLimit      int
+	RateLimitBurst int
+	MaxBodySize    int
+
+	Mocks string
+
+	FaultPath    string
+	FaultPercent int
+	FaultLatency time.Duration
+	FaultStatus  int
+	FaultDrop    bool
+
+	Provider       string
+	ServerBaseURL  string
+	MaxConnections int
+	LocalAddr      string
+	MDNSName       string
+	SSHHost        string
+	SSHKey         string
+	SSHRemoteAddr  string
+	SSHURL         string
 
 	ExecCommand     []string
 	WatchForChanges bool
+	UsePTY          bool
 
 	StandaloneMode bool
 	ShowVersion    bool
+
+	AdminAddr  string
+	AdminToken string
+	URLFile    string
+
+	MaxLines int
+
+	LogFormat string
+	LogLevel  string
+
+	AccessLogFormat      string
+	SlowRequestThreshold time.Duration
+
+	LogFile           string
+	LogFileFormat     string
+	LogFileMaxSize    int
+	LogFileMaxBackups int
 }
 
 // Loads the configuration.
@@ -40,12 +96,196 @@ func Load() *Config {
 		"http",
 		"The scheme to use for the forwarding.",
 	)
+	loadStringOption(
+		&c.ListenSocket,
+		"socket",
+		"",
+		"Forward the traffic to this Unix domain socket, instead of the port.",
+	)
+	loadStringOption(
+		&c.Mode,
+		"mode",
+		"http",
+		"Either http (the reverse proxy), or tcp to pipe the raw connections, i.e., for databases.",
+	)
+	loadStringOption(
+		&c.Static,
+		"static",
+		"",
+		"Serve this directory, instead of forwarding the traffic to a port.",
+	)
+	loadBoolOption(
+		&c.StaticListing,
+		"static-listing",
+		false,
+		"List the contents of the static directories without an index.html.",
+	)
+	loadBoolOption(
+		&c.StaticSPA,
+		"static-spa",
+		false,
+		"Serve the static index.html for the pages that don't exist, for single-page apps.",
+	)
+	loadBoolOption(
+		&c.H2C,
+		"h2c",
+		false,
+		"Use HTTP/2 cleartext (h2c) with the local server, and accept it from the tunnel, i.e., for gRPC.",
+	)
+	loadBoolOption(
+		&c.UpstreamInsecure,
+		"upstream-insecure",
+		false,
+		"Skip verifying the local server's certificate, when using the https scheme.",
+	)
+	loadStringOption(
+		&c.UpstreamCA,
+		"upstream-ca",
+		"",
+		"A PEM bundle of CAs to trust for the local server's certificate.",
+	)
+	loadStringOption(
+		&c.UpstreamServerName,
+		"upstream-server-name",
+		"",
+		"The server name (SNI) sent to the local server, defaults to the host.",
+	)
+	loadStringOption(
+		&c.UpstreamCert,
+		"upstream-cert",
+		"",
+		"A PEM client certificate to present to the local server (mTLS).",
+	)
+	loadStringOption(
+		&c.UpstreamKey,
+		"upstream-key",
+		"",
+		"The PEM private key of the client certificate.",
+	)
+	loadStringOption(
+		&c.HostHeader,
+		"host-header",
+		"preserve",
+		"The Host header sent to the local server, either preserve (the public host) or local.",
+	)
+	loadListOption(
+		&c.RequestHeaders,
+		"request-header",
+		"Set a request header, as 'Name: value', or remove it, as '-Name'. Can be repeated.",
+	)
+	loadListOption(
+		&c.ResponseHeaders,
+		"response-header",
+		"Set a response header, as 'Name: value', or remove it, as '-Name'. Can be repeated.",
+	)
+	loadIntOption(
+		&c.RateLimit,
+		"rate-limit",
+		0,
+		"The requests per second allowed per client IP, the rest get a 429, 0 to disable it.",
+	)
+	loadIntOption(
+		&c.RateLimitBurst,
+		"rate-limit-burst",
+		0,
+		"The requests a client can make at once, over the rate limit, defaults to the rate limit.",
+	)
+	loadIntOption(
+		&c.MaxBodySize,
+		"max-body-size",
+		0,
+		"The maximum request body size in megabytes, larger ones get a 413, 0 to disable it.",
+	)
+	loadStringOption(
+		&c.Mocks,
+		"mocks",
+		"",
+		"A JSON file with canned responses for the matching requests, the rest are proxied.",
+	)
+	loadStringOption(
+		&c.FaultPath,
+		"fault-path",
+		"",
+		"Inject the faults only into the requests matching this path pattern, i.e., /api/*.",
+	)
+	loadIntOption(
+		&c.FaultPercent,
+		"fault-percent",
+		100,
+		"The percentage of the requests to inject the faults into.",
+	)
+	loadDurationOption(
+		&c.FaultLatency,
+		"fault-latency",
+		0,
+		"Delay the faulty requests by this duration.",
+	)
+	loadIntOption(
+		&c.FaultStatus,
+		"fault-status",
+		0,
+		"Respond to the faulty requests with this 5xx status, instead of proxying them.",
+	)
+	loadBoolOption(
+		&c.FaultDrop,
+		"fault-drop",
+		false,
+		"Drop the connection of the faulty requests, without a response.",
+	)
 	loadStringOption(
 		&c.ServerBaseURL,
 		"server-base-url",
 		"https://localtunnel.me",
 		"The local tunner server URL.",
 	)
+	loadIntOption(
+		&c.MaxConnections,
+		"max-connections",
+		10,
+		"The maximum number of connections in the localtunnel pool, the server may allow fewer.",
+	)
+	loadStringOption(
+		&c.Provider,
+		"provider",
+		"localtunnel",
+		"The tunnel provider, either localtunnel, ssh (a reverse tunnel on your server), or local (LAN only).",
+	)
+	loadStringOption(
+		&c.LocalAddr,
+		"local-addr",
+		":0",
+		"The address to listen on with the local provider.",
+	)
+	loadStringOption(
+		&c.MDNSName,
+		"mdns-name",
+		"",
+		"Advertise the local provider via mDNS, reachable at name.local.",
+	)
+	loadStringOption(
+		&c.SSHHost,
+		"ssh-host",
+		"",
+		"The server for the ssh provider, as [user@]host[:port].",
+	)
+	loadStringOption(
+		&c.SSHKey,
+		"ssh-key",
+		"",
+		"The private key for the ssh provider, defaults to the SSH agent and the keys in ~/.ssh.",
+	)
+	loadStringOption(
+		&c.SSHRemoteAddr,
+		"ssh-remote-addr",
+		"0.0.0.0:8080",
+		"The address the ssh provider listens on in the server.",
+	)
+	loadStringOption(
+		&c.SSHURL,
+		"ssh-url",
+		"",
+		"The public URL of the ssh provider's tunnel, defaults to http://host:port.",
+	)
 	loadBoolOption(
 		&c.StandaloneMode,
 		"standalone",
@@ -58,6 +298,84 @@ func Load() *Config {
 		false,
 		"Watch for changes in the current directory, and restart command.",
 	)
+	loadIntOption(
+		&c.MaxLines,
+		"max-lines",
+		1000,
+		"The number of log lines to keep in the Terminal UI history.",
+	)
+	loadBoolOption(
+		&c.UsePTY,
+		"pty",
+		false,
+		"Run the command in a pseudo-terminal, so it keeps its colors.",
+	)
+	loadStringOption(
+		&c.LogFormat,
+		"log-format",
+		"text",
+		"The format of tube's logs, either text, json, or logfmt.",
+	)
+	loadStringOption(
+		&c.LogLevel,
+		"log-level",
+		"info",
+		"The minimum level of tube's logs, either debug, info, warn, or error.",
+	)
+	loadStringOption(
+		&c.AccessLogFormat,
+		"access-log-format",
+		"styled",
+		"The format of the requests log, either styled, common, or combined.",
+	)
+	loadDurationOption(
+		&c.SlowRequestThreshold,
+		"slow-request-threshold",
+		time.Second,
+		"Requests taking longer than this duration are highlighted.",
+	)
+	loadStringOption(
+		&c.LogFile,
+		"log-file",
+		"",
+		"Write the session logs (tube events and command output) to this file.",
+	)
+	loadStringOption(
+		&c.LogFileFormat,
+		"log-file-format",
+		"text",
+		"The format of the log file, either text or json (JSON lines).",
+	)
+	loadIntOption(
+		&c.LogFileMaxSize,
+		"log-file-max-size",
+		10,
+		"The size in megabytes at which the log file is rotated, 0 to disable rotation.",
+	)
+	loadIntOption(
+		&c.LogFileMaxBackups,
+		"log-file-max-backups",
+		3,
+		"The number of rotated log files to keep.",
+	)
+	loadStringOption(
+		&c.AdminAddr,
+		"admin-addr",
+		"",
+		"Expose a local control API on this address, i.e. 127.0.0.1:4040, unix:/path/to.sock, or auto for a socket per project.",
+	)
+	loadStringOption(
+		&c.AdminToken,
+		"admin-token",
+		"",
+		"The token the control API requires, a random one is written to the instance's state by default.",
+	)
+	loadStringOption(
+		&c.URLFile,
+		"url-file",
+		"",
+		"Write the tunnel's public URL to this file, it's removed on exit.",
+	)
 	loadBoolOption(
 		&c.ShowVersion,
 		"version",
@@ -67,36 +385,55 @@ func Load() *Config {
 	flag.Usage = func() {
 		fmt.Fprintf(
 			flag.CommandLine.Output(),
-			`Usage:	%s [options] [port] [command to execute...]:
+			`Usage:	%s [options] [port|unix:path] [command to execute...]:
 
 Starts a localtunnel.me tunnel on the  specified port. You can specify the
 options by argument  flags,  or  by  setting an environment variable, i.e.
 TUBE_HOST or  -host. Arguments take precedence over environment variables.
 
 The port can be either specified  as the first argument  or  the TUBE_PORT
-environment variable.
+environment variable. To forward to a Unix domain socket, use -socket, or
+unix:/path/to.sock as the first argument. To serve a directory instead, use
+-static.
 The  command  to execute, is optional, it can be  the  last  argument,  of
 specied by setting TUBE_EXEC_COMMAND.
 
+To control the instance running in the current directory, use:
+	%s url|reload|status|logs [-json]
+
+To run a localtunnel-compatible server, use:
+	%s server [-addr :8080] [-domain example.com]
+
 Options:
 `,
-			os.Args[0])
+			os.Args[0], os.Args[0], os.Args[0])
 		flag.PrintDefaults()
 	}
 	flag.Parse()
 
-	loadArgumentOptions(&c.ListenPort, &c.ExecCommand)
+	loadArgumentOptions(&c.ListenPort, &c.ListenSocket, &c.ExecCommand)
+	c.ListenSocket = parseSocket(c.ListenSocket)
 	return c
 }
 
-// Returns the host:port pair.
+// Returns the host:port pair, or only the host when forwarding to a socket.
 func (c *Config) ListenHostWithPort() string {
+	if len(c.ListenSocket) > 0 {
+		return c.ListenHost
+	}
 	return fmt.Sprintf("%s:%s", c.ListenHost, c.ListenPort)
 }
 
-// Returns the URL where to listen.
+// Returns the URL where to listen, with the tcp scheme in the tcp mode.
 func (c *Config) ListenURL() string {
-	return fmt.Sprintf("%s://%s", c.ListenScheme, c.ListenHostWithPort())
+	scheme := c.ListenScheme
+	if c.Mode == "tcp" {
+		scheme = "tcp"
+	}
+	if len(c.ListenSocket) > 0 {
+		return fmt.Sprintf("%s://unix:%s", scheme, c.ListenSocket)
+	}
+	return fmt.Sprintf("%s://%s", scheme, c.ListenHostWithPort())
 }
 
 func loadBoolOption(ptr *bool, option string, fallback bool, help string) {
@@ -108,10 +445,37 @@ func loadBoolOption(ptr *bool, option string, fallback bool, help string) {
 	)
 }
 
+func loadIntOption(ptr *int, option string, fallback int, help string) {
+	flag.IntVar(
+		ptr,
+		option,
+		parseInt(loadEnvVar(option, strconv.Itoa(fallback)), fallback),
+		help,
+	)
+}
+
+func loadDurationOption(ptr *time.Duration, option string, fallback time.Duration, help string) {
+	flag.DurationVar(
+		ptr,
+		option,
+		parseDuration(loadEnvVar(option, fallback.String()), fallback),
+		help,
+	)
+}
+
 func loadStringOption(ptr *string, option, fallback, help string) {
 	flag.StringVar(ptr, option, loadEnvVar(option, fallback), help)
 }
 
+// Loads an option that can be specified multiple times, the environment
+// variable holds the values separated by new lines.
+func loadListOption(ptr *[]string, option, help string) {
+	if v := loadEnvVar(option, ""); len(v) > 0 {
+		*ptr = strings.Split(v, "\n")
+	}
+	flag.Var(&listValue{values: ptr}, option, help)
+}
+
 func loadEnvVar(option, fallback string) string {
 	if v, ok := os.LookupEnv(formatEnvVar(option)); ok {
 		return v
@@ -119,7 +483,7 @@ func loadEnvVar(option, fallback string) string {
 	return fallback
 }
 
-func loadArgumentOptions(port *string, program *[]string) {
+func loadArgumentOptions(port, socket *string, program *[]string) {
 	if v, ok := os.LookupEnv(formatEnvVar("port")); ok {
 		*port = v
 	}
@@ -133,12 +497,48 @@ func loadArgumentOptions(port *string, program *[]string) {
 			if len(flag.Args()) > 2 {
 				*program = flag.Args()[1:]
 			}
+		} else if strings.HasPrefix(flag.Arg(0), "unix:") {
+			*socket = flag.Arg(0)
+			if len(flag.Args()) > 1 {
+				*program = flag.Args()[1:]
+			}
 		} else {
 			*program = flag.Args()
 		}
 	}
 }
 
+// listValue is a flag.Value that appends every value. The values from the
+// arguments replace the ones from the environment variable.
+type listValue struct {
+	values *[]string
+	set    bool
+}
+
+func (l *listValue) String() string {
+	if l.values == nil {
+		return ""
+	}
+	return strings.Join(*l.values, ", ")
+}
+
+func (l *listValue) Set(value string) error {
+	if !l.set {
+		*l.values = nil
+		l.set = true
+	}
+	*l.values = append(*l.values, value)
+	return nil
+}
+
+// Returns the path of the socket, without the unix: (or unix://) prefix.
+func parseSocket(socket string) string {
+	if path, ok := strings.CutPrefix(socket, "unix://"); ok {
+		return path
+	}
+	return strings.TrimPrefix(socket, "unix:")
+}
+
 func formatEnvVar(envVar string) string {
 	return fmt.Sprintf(
 		"%s_%s",
@@ -154,3 +554,19 @@ func parseBool(value string) bool {
 	}
 	return b
 }
+
+func parseInt(value string, fallback int) int {
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return fallback
+	}
+	return i
+}
+
+func parseDuration(value string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fallback
+	}
+	return d
+}
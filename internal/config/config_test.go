@@ -0,0 +1,144 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+// Replaces the command line flags with a new set for the test, the options
+// are loaded into it.
+func withFlags(t *testing.T) {
+	t.Helper()
+	saved := flag.CommandLine
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	flag.CommandLine.SetOutput(io.Discard)
+	t.Cleanup(func() { flag.CommandLine = saved })
+}
+
+func TestLoadListOption(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		args []string
+		want []string
+	}{
+		{"unset", "", nil, nil},
+		{"environment", "X-One: 1\nX-Two: 2", nil, []string{"X-One: 1", "X-Two: 2"}},
+		{"arguments", "", []string{"-header", "X-One: 1", "-header", "-X-Two"}, []string{"X-One: 1", "-X-Two"}},
+		{"arguments replace environment", "X-One: 1", []string{"-header", "X-Two: 2"}, []string{"X-Two: 2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withFlags(t)
+			if len(tt.env) > 0 {
+				t.Setenv("TUBE_HEADER", tt.env)
+			}
+			var got []string
+			loadListOption(&got, "header", "")
+			if err := flag.CommandLine.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadDurationOption(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		args    []string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"fallback", "", nil, time.Second, false},
+		{"environment", "250ms", nil, 250 * time.Millisecond, false},
+		{"invalid environment", "soon", nil, time.Second, false},
+		{"argument", "250ms", []string{"-timeout", "2m"}, 2 * time.Minute, false},
+		{"invalid argument", "", []string{"-timeout", "10"}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withFlags(t)
+			if len(tt.env) > 0 {
+				t.Setenv("TUBE_TIMEOUT", tt.env)
+			}
+			var got time.Duration
+			loadDurationOption(&got, "timeout", time.Second, "")
+			if err := flag.CommandLine.Parse(tt.args); (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadIntOption(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		args []string
+		want int
+	}{
+		{"fallback", "", nil, 10},
+		{"environment", "3", nil, 3},
+		{"invalid environment", "three", nil, 10},
+		{"argument", "3", []string{"-rate-limit", "5"}, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withFlags(t)
+			if len(tt.env) > 0 {
+				t.Setenv("TUBE_RATE_LIMIT", tt.env)
+			}
+			var got int
+			loadIntOption(&got, "rate-limit", 10, "")
+			if err := flag.CommandLine.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSocket(t *testing.T) {
+	tests := []struct {
+		socket, want string
+	}{
+		{"", ""},
+		{"/tmp/app.sock", "/tmp/app.sock"},
+		{"unix:/tmp/app.sock", "/tmp/app.sock"},
+		{"unix:///tmp/app.sock", "/tmp/app.sock"},
+		{"unix:app.sock", "app.sock"},
+	}
+	for _, tt := range tests {
+		if got := parseSocket(tt.socket); got != tt.want {
+			t.Errorf("parseSocket(%q) = %q, want %q", tt.socket, got, tt.want)
+		}
+	}
+}
+
+func TestFormatEnvVar(t *testing.T) {
+	tests := []struct {
+		option, want string
+	}{
+		{"port", "TUBE_PORT"},
+		{"rate-limit-burst", "TUBE_RATE_LIMIT_BURST"},
+		{"upstream-ca", "TUBE_UPSTREAM_CA"},
+	}
+	for _, tt := range tests {
+		if got := formatEnvVar(tt.option); got != tt.want {
+			t.Errorf("formatEnvVar(%q) = %q, want %q", tt.option, got, tt.want)
+		}
+	}
+}
@@ -6,21 +6,35 @@ import (
 	stdlog "log"
 
 	"github.com/charmbracelet/log"
+
+	"github.com/ivanvc/tube/internal/config"
 )
 
 // BufferedLogger holds a common logger writing to a reader to consume it from the UI.
 type BufferedLogger struct {
 	*log.Logger
 	reader *bufio.Reader
+	writer io.Writer
+	output io.Writer
 }
 
 // Returns a new BufferedLogger that has the output to a buffered reader.
-func NewBuffered() *BufferedLogger {
+func NewBuffered(cfg *config.Config) *BufferedLogger {
 	r, w := io.Pipe()
-	return &BufferedLogger{
+	l := &BufferedLogger{
 		Logger: log.NewWithOptions(w, log.Options{ReportTimestamp: true}),
 		reader: bufio.NewReader(r),
+		writer: w,
+		output: w,
 	}
+	configure(l.Logger, cfg)
+	return l
+}
+
+// Writes the output of the logger to w as well.
+func (l *BufferedLogger) Tee(w io.Writer) {
+	l.output = io.MultiWriter(l.writer, w)
+	l.SetOutput(l.output)
 }
 
 // Returns a standard log with the lever forced to Error.
@@ -44,3 +58,8 @@ func (l *BufferedLogger) Reader() *bufio.Reader {
 func (l *BufferedLogger) Log() *log.Logger {
 	return l.Logger
 }
+
+// Returns the writer where the logger outputs, to write raw lines.
+func (l *BufferedLogger) Writer() io.Writer {
+	return l.output
+}
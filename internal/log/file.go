@@ -0,0 +1,116 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ivanvc/tube/internal/config"
+)
+
+// File writes the session logs to a file, tagging every line with a
+// timestamp and the stream it comes from. Once the file reaches its maximum
+// size, it's rotated.
+type File struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	json       bool
+	file       *os.File
+	size       int64
+}
+
+// Returns a new File, opening (or creating) the file from the configuration.
+func NewFile(cfg *config.Config) (*File, error) {
+	f := &File{
+		path:       cfg.LogFile,
+		maxSize:    int64(cfg.LogFileMaxSize) * 1024 * 1024,
+		maxBackups: cfg.LogFileMaxBackups,
+		json:       cfg.LogFileFormat == "json",
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Returns a writer that writes every line to the file, tagged with stream.
+func (f *File) Writer(stream string) io.Writer {
+	return &lineWriter{stream: stream, writeLine: f.writeLine}
+}
+
+// Closes the file.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func (f *File) writeLine(stream string, line []byte) error {
+	var entry []byte
+	now := time.Now()
+	if f.json {
+		var err error
+		entry, err = json.Marshal(struct {
+			Time    time.Time `json:"time"`
+			Stream  string    `json:"stream"`
+			Message string    `json:"message"`
+		}{now, stream, string(line)})
+		if err != nil {
+			return err
+		}
+		entry = append(entry, '\n')
+	} else {
+		entry = []byte(fmt.Sprintf("%s [%s] %s\n", now.Format(time.RFC3339), stream, line))
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(entry)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := f.file.Write(entry)
+	f.size += int64(n)
+	return err
+}
+
+// Renames the file to path.1, the previous path.1 to path.2, and so on,
+// removing the ones past maxBackups. Then, opens a new file.
+func (f *File) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	if f.maxBackups > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", f.path, f.maxBackups))
+		for i := f.maxBackups - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+		}
+		if err := os.Rename(f.path, f.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(f.path); err != nil {
+		return err
+	}
+	return f.open()
+}
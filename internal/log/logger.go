@@ -2,9 +2,12 @@ package log
 
 import (
 	"bufio"
+	"io"
 	stdlog "log"
 
 	"github.com/charmbracelet/log"
+
+	"github.com/ivanvc/tube/internal/config"
 )
 
 // Logger is the interface for a logger that can output to a buffer or stdout.
@@ -13,4 +16,29 @@ type Logger interface {
 	GetStandardLogWithErrorLevel() *stdlog.Logger
 	GetStandardLog() *stdlog.Logger
 	Log() *log.Logger
+	Writer() io.Writer
+}
+
+var formatters = map[string]log.Formatter{
+	"text":   log.TextFormatter,
+	"json":   log.JSONFormatter,
+	"logfmt": log.LogfmtFormatter,
+}
+
+// Returns true if format is a supported log format.
+func ValidFormat(format string) bool {
+	_, ok := formatters[format]
+	return ok
+}
+
+// Returns true if level is a supported log level.
+func ValidLevel(level string) bool {
+	l := log.ParseLevel(level)
+	return l.String() == level && l < log.FatalLevel
+}
+
+// Sets the formatter and level from the configuration.
+func configure(l *log.Logger, cfg *config.Config) {
+	l.SetFormatter(formatters[cfg.LogFormat])
+	l.SetLevel(log.ParseLevel(cfg.LogLevel))
 }
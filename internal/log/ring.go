@@ -0,0 +1,73 @@
+package log
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Line is a line of the session logs. Seq numbers the lines in the order
+// they're written, starting from 1.
+type Line struct {
+	Seq     uint64
+	Time    time.Time
+	Stream  string
+	Message string
+}
+
+// Ring keeps the most recent lines of the session logs.
+type Ring struct {
+	mu    sync.Mutex
+	lines []Line
+	next  int
+	seq   uint64
+}
+
+// Returns a new Ring keeping up to size lines.
+func NewRing(size int) *Ring {
+	if size < 1 {
+		size = 1
+	}
+	return &Ring{lines: make([]Line, 0, size)}
+}
+
+// Returns a writer that keeps every line, tagged with stream.
+func (r *Ring) Writer(stream string) io.Writer {
+	return &lineWriter{stream: stream, writeLine: r.writeLine}
+}
+
+// Returns up to the last n lines (all of them if n is 0) written after the
+// line numbered since, the oldest first.
+func (r *Ring) Lines(n int, since uint64) []Line {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ordered := append(append([]Line(nil), r.lines[r.next:]...), r.lines[:r.next]...)
+	// The lines are numbered in order, without gaps.
+	if len(ordered) > 0 && since >= ordered[0].Seq {
+		skip := len(ordered)
+		if since < r.seq {
+			skip = int(since - ordered[0].Seq + 1)
+		}
+		ordered = ordered[skip:]
+	}
+	if n > 0 && n < len(ordered) {
+		ordered = ordered[len(ordered)-n:]
+	}
+	return ordered
+}
+
+func (r *Ring) writeLine(stream string, line []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seq++
+	l := Line{Seq: r.seq, Time: time.Now(), Stream: stream, Message: string(line)}
+	if len(r.lines) < cap(r.lines) {
+		r.lines = append(r.lines, l)
+		return nil
+	}
+	r.lines[r.next] = l
+	r.next = (r.next + 1) % len(r.lines)
+	return nil
+}
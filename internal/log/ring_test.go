@@ -0,0 +1,45 @@
+package log
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRingLines(t *testing.T) {
+	r := NewRing(5)
+	w := r.Writer("stdout")
+	for i := 1; i <= 8; i++ {
+		fmt.Fprintf(w, "line %d\n", i)
+	}
+
+	tests := []struct {
+		name  string
+		n     int
+		since uint64
+		want  []uint64
+	}{
+		{"all", 0, 0, []uint64{4, 5, 6, 7, 8}},
+		{"last", 2, 0, []uint64{7, 8}},
+		{"more than kept", 10, 0, []uint64{4, 5, 6, 7, 8}},
+		{"since", 0, 6, []uint64{7, 8}},
+		{"since discarded", 0, 2, []uint64{4, 5, 6, 7, 8}},
+		{"since last", 0, 8, nil},
+		{"since future", 0, 20, nil},
+		{"since and last", 1, 5, []uint64{8}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := r.Lines(tt.n, tt.since)
+			var got []uint64
+			for _, l := range lines {
+				if l.Message != fmt.Sprintf("line %d", l.Seq) {
+					t.Errorf("line %d has message %q", l.Seq, l.Message)
+				}
+				got = append(got, l.Seq)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
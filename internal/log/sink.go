@@ -0,0 +1,60 @@
+package log
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"sync"
+)
+
+var ansiSequence = regexp.MustCompile("\x1b(\\[[0-9;?]*[ -/]*[@-~]|\\][^\a\x1b]*(\a|\x1b\\\\)|[@-Z\\\\-_])")
+
+// Sink receives the lines of the session logs, tagged by the stream they come
+// from.
+type Sink interface {
+	Writer(stream string) io.Writer
+}
+
+// MultiSink writes the lines to all of its sinks.
+type MultiSink []Sink
+
+// Returns a writer that writes to the writers of all of the sinks.
+func (m MultiSink) Writer(stream string) io.Writer {
+	writers := make([]io.Writer, len(m))
+	for i, s := range m {
+		writers[i] = s.Writer(stream)
+	}
+	return io.MultiWriter(writers...)
+}
+
+type lineWriter struct {
+	mu        sync.Mutex
+	stream    string
+	writeLine func(stream string, line []byte) error
+	buf       []byte
+}
+
+// Write implements io.Writer. It buffers the partial lines until they are
+// complete. Only the text after the last carriage return of a line is
+// written, and the escape sequences are removed.
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := bytes.TrimRight(w.buf[:i], "\r")
+		if j := bytes.LastIndexByte(line, '\r'); j >= 0 {
+			line = line[j+1:]
+		}
+		line = ansiSequence.ReplaceAll(line, nil)
+		if err := w.writeLine(w.stream, line); err != nil {
+			return len(p), err
+		}
+		w.buf = w.buf[i+1:]
+	}
+}
@@ -0,0 +1,56 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestLineWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   []string
+	}{
+		{"line", []string{"hello\n"}, []string{"hello"}},
+		{"lines", []string{"a\nb\n"}, []string{"a", "b"}},
+		{"partial", []string{"hel", "lo\nwor", "ld"}, []string{"hello"}},
+		{"empty line", []string{"\n"}, []string{""}},
+		{"crlf", []string{"hello\r\n"}, []string{"hello"}},
+		{"carriage return", []string{"10%\r50%\r100%\n"}, []string{"100%"}},
+		{"colors", []string{"\x1b[1;31mred\x1b[0m\n"}, []string{"red"}},
+		{"private mode", []string{"\x1b[?25lhidden cursor\x1b[?25h\n"}, []string{"hidden cursor"}},
+		{"erase line", []string{"\x1b[2K\x1b[1Gdone\n"}, []string{"done"}},
+		{"hyperlink", []string{"\x1b]8;;https://example.com\x07link\x1b]8;;\x1b\\\n"}, []string{"link"}},
+		{"title", []string{"\x1b]0;title\x1b\\text\n"}, []string{"text"}},
+		{"split sequence", []string{"\x1b[3", "1mred\n"}, []string{"red"}},
+		{"two bytes sequence", []string{"\x1bMup\n"}, []string{"up"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			w := &lineWriter{stream: "stdout", writeLine: func(stream string, line []byte) error {
+				got = append(got, string(line))
+				return nil
+			}}
+			for _, s := range tt.writes {
+				if n, err := w.Write([]byte(s)); n != len(s) || err != nil {
+					t.Fatalf("Write(%q) = %d, %v", s, n, err)
+				}
+			}
+			if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLineWriterError(t *testing.T) {
+	failed := errors.New("failed")
+	w := &lineWriter{writeLine: func(stream string, line []byte) error {
+		return failed
+	}}
+	if _, err := w.Write([]byte("hello\n")); !errors.Is(err, failed) {
+		t.Errorf("got %v, want %v", err, failed)
+	}
+}
@@ -2,19 +2,32 @@ package log
 
 import (
 	"bufio"
+	"io"
 	stdlog "log"
+	"os"
 
 	"github.com/charmbracelet/log"
+
+	"github.com/ivanvc/tube/internal/config"
 )
 
 // StdoutLogger holds a common logger writing to a reader to consume it from the UI.
 type StdoutLogger struct {
 	*log.Logger
+	output io.Writer
 }
 
 // Returns a new StdoutLogger that outputs to the stdout.
-func NewStdout() *StdoutLogger {
-	return &StdoutLogger{log.Default()}
+func NewStdout(cfg *config.Config) *StdoutLogger {
+	l := &StdoutLogger{Logger: log.Default(), output: os.Stderr}
+	configure(l.Logger, cfg)
+	return l
+}
+
+// Writes the output of the logger to w as well.
+func (l *StdoutLogger) Tee(w io.Writer) {
+	l.output = &teeFile{File: os.Stderr, tee: w}
+	l.SetOutput(l.output)
 }
 
 // Returns a standard log with the lever forced to Error.
@@ -38,3 +51,20 @@ func (l *StdoutLogger) Reader() *bufio.Reader {
 func (l *StdoutLogger) Log() *log.Logger {
 	return l.Logger
 }
+
+// Returns the writer where the logger outputs, to write raw lines.
+func (l *StdoutLogger) Writer() io.Writer {
+	return l.output
+}
+
+// teeFile writes to the file and to tee. It embeds the file, so the logger
+// can still detect if it's a terminal, and keep its colors.
+type teeFile struct {
+	*os.File
+	tee io.Writer
+}
+
+func (f *teeFile) Write(p []byte) (int, error) {
+	f.tee.Write(p)
+	return f.File.Write(p)
+}
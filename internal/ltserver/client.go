@@ -0,0 +1,210 @@
+package ltserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+	"time"
+
+	"github.com/ivanvc/tube/internal/log"
+)
+
+const (
+	// The time a client has to open its first socket, and to reopen one after
+	// all of them were closed, before the tunnel is removed.
+	graceTimeout = 5 * time.Second
+	// The time a request waits for an idle socket.
+	socketTimeout = 30 * time.Second
+)
+
+var errClientClosed = errors.New("tunnel closed")
+
+// client is a tunnel: a TCP listener where the localtunnel client opens a pool
+// of sockets, to proxy the requests to its subdomain through them.
+type client struct {
+	id         string
+	logger     log.Logger
+	listener   net.Listener
+	maxSockets int
+	proxy      *httputil.ReverseProxy
+	onClose    func()
+
+	mu        sync.Mutex
+	connected int
+	idle      chan net.Conn
+	grace     *time.Timer
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newClient(id string, listener net.Listener, maxSockets int, logger log.Logger, onClose func()) *client {
+	c := &client{
+		id:         id,
+		logger:     logger,
+		listener:   listener,
+		maxSockets: maxSockets,
+		onClose:    onClose,
+		idle:       make(chan net.Conn, maxSockets),
+		done:       make(chan struct{}),
+	}
+	c.proxy = &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			r.URL.Scheme = "http"
+			r.URL.Host = r.Host
+		},
+		Transport: &http.Transport{
+			DialContext:     c.dial,
+			MaxConnsPerHost: maxSockets,
+			// Keep every socket after a request, instead of closing the ones
+			// over the default of 2, which makes the client reopen them.
+			MaxIdleConnsPerHost: maxSockets,
+		},
+		ErrorLog:     logger.GetStandardLogWithErrorLevel(),
+		ErrorHandler: c.handleError,
+	}
+	c.grace = time.AfterFunc(graceTimeout, c.close)
+	go c.accept()
+	return c
+}
+
+// Returns the port where the client opens the sockets.
+func (c *client) port() int {
+	return c.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Returns the number of sockets opened by the client.
+func (c *client) sockets() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
+func (c *client) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.proxy.ServeHTTP(w, r)
+}
+
+// Accepts the client's sockets. The ones over maxSockets are not rejected,
+// as the localtunnel client closes the tunnel if a new socket is closed, but
+// they wait until there's room in the pool.
+func (c *client) accept() {
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			c.close()
+			return
+		}
+		c.mu.Lock()
+		c.connected++
+		c.grace.Stop()
+		c.mu.Unlock()
+
+		s := &socket{Conn: conn, client: c}
+		select {
+		case c.idle <- s:
+			continue
+		default:
+		}
+		c.prune()
+		select {
+		case c.idle <- s:
+		case <-c.done:
+			s.Close()
+		}
+	}
+}
+
+// Closes the idle sockets that were closed by the client.
+func (c *client) prune() {
+	for i := len(c.idle); i > 0; i-- {
+		select {
+		case conn := <-c.idle:
+			if alive(conn) {
+				c.idle <- conn
+			} else {
+				conn.Close()
+			}
+		default:
+			return
+		}
+	}
+}
+
+// Returns an idle socket for the transport, waiting for one if all of them
+// are busy.
+func (c *client) dial(ctx context.Context, _, _ string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, socketTimeout)
+	defer cancel()
+	for {
+		select {
+		case conn := <-c.idle:
+			if alive(conn) {
+				return conn, nil
+			}
+			conn.Close()
+		case <-c.done:
+			return nil, errClientClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (c *client) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	c.logger.Log().Error("error proxying request", "tunnel", c.id, "error", err)
+	w.WriteHeader(http.StatusBadGateway)
+}
+
+// Called when a socket is closed. Once all of them are closed, the client
+// has graceTimeout to reconnect.
+func (c *client) socketClosed() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.connected--; c.connected == 0 {
+		c.grace.Reset(graceTimeout)
+	}
+}
+
+func (c *client) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.listener.Close()
+		c.proxy.Transport.(*http.Transport).CloseIdleConnections()
+		for {
+			select {
+			case conn := <-c.idle:
+				conn.Close()
+			default:
+				c.onClose()
+				return
+			}
+		}
+	})
+}
+
+// socket is a connection opened by the client.
+type socket struct {
+	net.Conn
+	client *client
+	once   sync.Once
+}
+
+func (s *socket) Close() error {
+	err := s.Conn.Close()
+	s.once.Do(s.client.socketClosed)
+	return err
+}
+
+// Returns false if the idle socket was closed by the client. The client
+// never writes before receiving a request, so a read only returns if the
+// socket was closed.
+func alive(conn net.Conn) bool {
+	conn.SetReadDeadline(time.Now().Add(time.Millisecond))
+	defer conn.SetReadDeadline(time.Time{})
+	var b [1]byte
+	_, err := conn.Read(b[:])
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,199 @@
+package ltserver
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/ivanvc/tube/internal/log"
+)
+
+// The subdomains clients can request, same as the localtunnel server.
+var validID = regexp.MustCompile(`^(?:[a-z0-9][a-z0-9\-]{4,63}[a-z0-9]|[a-z0-9]{4,63})$`)
+
+// Options holds the configuration of the server.
+type Options struct {
+	// The address to listen on for HTTP requests.
+	Addr string
+	// The domain the tunnels are subdomains of. If empty, the Host of the
+	// request creating the tunnel is used.
+	Domain string
+	// Use https in the tunnel URLs, when a proxy in front terminates TLS.
+	Secure bool
+	// The maximum number of sockets per client.
+	MaxSockets int
+}
+
+// Server is a localtunnel-compatible server. Clients request a tunnel with
+// GET /?new (or GET /<id> for a specific subdomain), and then open a pool of
+// sockets to the returned port. Requests to the tunnel's subdomain are
+// proxied through those sockets.
+type Server struct {
+	opts   Options
+	logger log.Logger
+	server *http.Server
+
+	mu      sync.Mutex
+	clients map[string]*client
+}
+
+// Returns a new Server.
+func New(opts Options, logger log.Logger) *Server {
+	s := &Server{opts: opts, logger: logger, clients: make(map[string]*client)}
+	s.server = &http.Server{
+		Addr:     opts.Addr,
+		Handler:  s,
+		ErrorLog: logger.GetStandardLogWithErrorLevel(),
+	}
+	return s
+}
+
+// Listens and serves the requests.
+func (s *Server) ListenAndServe() error {
+	s.logger.Log().Infof("localtunnel server listening on %s", s.opts.Addr)
+	if err := s.server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Terminates the server, and closes all the tunnels.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	clients := make([]*client, 0, len(s.clients))
+	for _, c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.mu.Unlock()
+	for _, c := range clients {
+		c.close()
+	}
+	return s.server.Close()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if c := s.route(r.Host); c != nil {
+		c.ServeHTTP(w, r)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/api/status":
+		s.mu.Lock()
+		tunnels := len(s.clients)
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]int{"tunnels": tunnels})
+	case strings.HasPrefix(r.URL.Path, "/api/tunnels/") && strings.HasSuffix(r.URL.Path, "/status"):
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/tunnels/"), "/status")
+		s.mu.Lock()
+		c, ok := s.clients[id]
+		s.mu.Unlock()
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"message": "Tunnel not found"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"connected_sockets": c.sockets()})
+	case r.URL.Path == "/" && r.URL.Query().Has("new"):
+		s.newClient(w, r, "")
+	case r.URL.Path != "/" && !strings.Contains(r.URL.Path[1:], "/"):
+		id := r.URL.Path[1:]
+		if !validID.MatchString(id) {
+			writeJSON(w, http.StatusForbidden, map[string]string{
+				"message": "Invalid subdomain. Subdomains must be lowercase and between 4 and 63 alphanumeric characters.",
+			})
+			return
+		}
+		s.newClient(w, r, id)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Creates a tunnel, and replies with its details. If the id is empty or
+// already taken, a random one is used.
+func (s *Server) newClient(w http.ResponseWriter, r *http.Request, id string) {
+	host, _, err := net.SplitHostPort(s.opts.Addr)
+	if err != nil {
+		host = ""
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		s.logger.Log().Error("error creating tunnel", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"message": "Error creating tunnel"})
+		return
+	}
+
+	s.mu.Lock()
+	for _, ok := s.clients[id]; len(id) == 0 || ok; _, ok = s.clients[id] {
+		id = randomID()
+	}
+	c := newClient(id, listener, s.opts.MaxSockets, s.logger, func() {
+		s.mu.Lock()
+		delete(s.clients, id)
+		s.mu.Unlock()
+		s.logger.Log().Info("tunnel closed", "id", id)
+	})
+	s.clients[id] = c
+	s.mu.Unlock()
+
+	scheme := "http"
+	if s.opts.Secure {
+		scheme = "https"
+	}
+	domain := s.opts.Domain
+	if len(domain) == 0 {
+		domain = r.Host
+	}
+	url := fmt.Sprintf("%s://%s.%s", scheme, id, domain)
+	s.logger.Log().Info("tunnel created", "id", id, "url", url, "port", c.port())
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":             id,
+		"port":           c.port(),
+		"max_conn_count": s.opts.MaxSockets,
+		"url":            url,
+	})
+}
+
+// Returns the client for the subdomain of host, nil if there's none.
+func (s *Server) route(host string) *client {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	var id string
+	if len(s.opts.Domain) > 0 {
+		domain, _, err := net.SplitHostPort(s.opts.Domain)
+		if err != nil {
+			domain = s.opts.Domain
+		}
+		var ok bool
+		if id, ok = strings.CutSuffix(host, "."+domain); !ok {
+			return nil
+		}
+	} else if i := strings.IndexByte(host, '.'); i > 0 {
+		id = host[:i]
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.clients[id]
+}
+
+func randomID() string {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, 10)
+	rand.Read(b)
+	for i := range b {
+		b[i] = alphabet[int(b[i])%len(alphabet)]
+	}
+	return string(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
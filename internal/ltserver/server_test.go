@@ -0,0 +1,68 @@
+package ltserver
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ivanvc/tube/internal/config"
+	"github.com/ivanvc/tube/internal/log"
+	"github.com/ivanvc/tube/internal/tunnel"
+)
+
+func TestRoundTrip(t *testing.T) {
+	cfg := &config.Config{Provider: "localtunnel", MaxConnections: 4}
+	logger := log.NewStdout(cfg)
+	s := New(Options{Addr: "127.0.0.1:0", MaxSockets: cfg.MaxConnections}, logger)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	defer s.Close()
+
+	cfg.ServerBaseURL = ts.URL
+	tun, err := tunnel.New(cfg, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, publicURL, err := tun.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", r.Method, r.URL.Path)
+	}))
+
+	u, err := url.Parse(publicURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _, _ := strings.Cut(u.Hostname(), ".")
+	// More requests than sockets, so they're reused.
+	for i := 0; i < 2*cfg.MaxConnections; i++ {
+		path := fmt.Sprintf("/%d", i)
+		req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Host = u.Host
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusOK || string(body) != "GET "+path {
+			t.Fatalf("got %d %q through tunnel %s, want 200 %q", res.StatusCode, body, id, "GET "+path)
+		}
+	}
+	if c := s.route(u.Host); c == nil || c.sockets() == 0 {
+		t.Fatalf("tunnel %s has no sockets", id)
+	}
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ivanvc/tube/internal/config"
+	"github.com/ivanvc/tube/internal/log"
+)
+
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// accessLog logs the completed requests, either styled by the logger, or in
+// the Common or Combined Log Format.
+type accessLog struct {
+	cfg    *config.Config
+	logger log.Logger
+}
+
+func newAccessLog(cfg *config.Config, logger log.Logger) *accessLog {
+	return &accessLog{cfg: cfg, logger: logger}
+}
+
+func (a *accessLog) log(req *http.Request, rw *responseRecorder, duration time.Duration) {
+	switch a.cfg.AccessLogFormat {
+	case "common":
+		fmt.Fprintln(a.logger.Writer(), commonLogLine(req, rw, duration))
+	case "combined":
+		fmt.Fprintf(
+			a.logger.Writer(),
+			"%s %q %q\n",
+			commonLogLine(req, rw, duration),
+			orDash(req.Referer()),
+			orDash(req.UserAgent()),
+		)
+	default:
+		a.logStyled(req, rw, duration)
+		return
+	}
+	if rw.err != nil {
+		a.logger.Log().Error("proxy error", "error", rw.err)
+	}
+}
+
+// Logs that a websocket (or another upgraded connection) or an event stream
+// was opened, they're logged as requests once they're closed.
+func (a *accessLog) logOpen(req *http.Request, kind string) {
+	if a.cfg.AccessLogFormat != "styled" {
+		return
+	}
+	a.logRequest(a.logger.Log().Info, req, "stream", kind, "state", "open", "client", clientIP(req))
+}
+
+// Logs the request with the logger. Failed requests are logged as errors,
+// and slow requests as warnings.
+func (a *accessLog) logStyled(req *http.Request, rw *responseRecorder, duration time.Duration) {
+	fields := []interface{}{
+		"status", rw.Status(),
+		"duration", duration,
+		"bytes", rw.BytesOut(),
+		"client", clientIP(req),
+	}
+	if rw.stream != nil {
+		fields = append(fields, streamFields(rw.stream)...)
+	}
+	var grpcFailed bool
+	if method, ok := grpcMethod(req); ok {
+		fields = append(fields, "grpc_method", method)
+		if code, ok := grpcStatus(rw.Header()); ok {
+			fields = append(fields, "grpc_status", grpcCodeName(code))
+			grpcFailed = grpcServerError(code)
+		}
+	}
+	if len(rw.limit) > 0 {
+		fields = append(fields, "limit", rw.limit)
+	}
+	if rw.mocked {
+		fields = append(fields, "mock", true)
+	}
+	if len(rw.fault) > 0 {
+		fields = append(fields, "fault", rw.fault)
+	}
+	if rw.err != nil {
+		fields = append(fields, "error", rw.err)
+	}
+
+	logger := a.logger.Log().Info
+	switch {
+	case rw.err != nil || rw.Status() >= http.StatusInternalServerError || grpcFailed:
+		logger = a.logger.Log().Error
+	// Streams last until they're closed.
+	case duration >= a.cfg.SlowRequestThreshold && rw.stream == nil:
+		logger = a.logger.Log().Warn
+		fields = append(fields, "slow", true)
+	}
+	a.logRequest(logger, req, fields...)
+}
+
+func (a *accessLog) logRequest(logger func(interface{}, ...interface{}), req *http.Request, fields ...interface{}) {
+	path := req.URL.Path
+	if len(req.URL.RawQuery) > 0 {
+		path += fmt.Sprintf("?%s", req.URL.RawQuery)
+	}
+	if a.cfg.LogFormat == "text" {
+		logger(fmt.Sprintf("%s %s", req.Method, path), fields...)
+		return
+	}
+	logger("request", append([]interface{}{"method", req.Method, "path", path}, fields...)...)
+}
+
+// Returns the fields of a closed stream: the bytes received from the client
+// of an upgraded connection, the messages of a websocket, or the events of an
+// event stream.
+func streamFields(s *stream) []interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fields := []interface{}{"stream", s.kind, "state", "closed"}
+	switch s.kind {
+	case sseStream:
+		return append(fields, "events", s.events)
+	case websocketStream:
+		fields = append(fields, "messages_in", s.messagesIn.messages, "messages_out", s.messagesOut.messages)
+	}
+	return append(fields, "bytes_in", s.bytesIn)
+}
+
+// Returns the request in the Common Log Format.
+func commonLogLine(req *http.Request, rw *responseRecorder, duration time.Duration) string {
+	user, _, _ := req.BasicAuth()
+	size := ""
+	if bytes := rw.BytesOut(); bytes > 0 {
+		size = fmt.Sprint(bytes)
+	}
+	return fmt.Sprintf(
+		"%s - %s [%s] \"%s %s %s\" %d %s",
+		clientIP(req),
+		orDash(user),
+		time.Now().Add(-duration).Format(clfTimeFormat),
+		req.Method,
+		req.RequestURI,
+		req.Proto,
+		rw.Status(),
+		orDash(size),
+	)
+}
+
+func orDash(s string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return s
+}
+
+// Returns the IP of the client, from the X-Forwarded-For header set by the
+// tunnel server, or the remote address. The client can set the header, so
+// it's only used for logging.
+func clientIP(req *http.Request) string {
+	if xff := req.Header.Get("X-Forwarded-For"); len(xff) > 0 {
+		ip, _, _ := strings.Cut(xff, ",")
+		return strings.TrimSpace(ip)
+	}
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ivanvc/tube/internal/config"
+)
+
+// faults injects latency, errors, or connection drops into a percentage of
+// the requests, to test how clients behave with a slow or failing server.
+type faults struct {
+	path    string
+	percent int
+	latency time.Duration
+	status  int
+	drop    bool
+
+	enabled atomic.Bool
+}
+
+// Returns an error if the fault injection options are invalid.
+func ValidateFaults(cfg *config.Config) error {
+	if cfg.FaultPercent < 0 || cfg.FaultPercent > 100 {
+		return fmt.Errorf("fault percent needs to be between 0 and 100, got %d", cfg.FaultPercent)
+	}
+	if cfg.FaultStatus != 0 && (cfg.FaultStatus < 500 || cfg.FaultStatus > 599) {
+		return fmt.Errorf("fault status needs to be a 5xx status, got %d", cfg.FaultStatus)
+	}
+	if cfg.FaultStatus != 0 && cfg.FaultDrop {
+		return errors.New("use either a fault status, or drop the connection")
+	}
+	if _, err := path.Match(cfg.FaultPath, "/"); err != nil {
+		return fmt.Errorf("invalid fault path pattern %q", cfg.FaultPath)
+	}
+	if cfg.Mode == "tcp" && newFaults(cfg).configured() {
+		return errors.New("fault injection needs the http mode")
+	}
+	return nil
+}
+
+// Returns the faults from the configuration, they start enabled if any is
+// configured.
+func newFaults(cfg *config.Config) *faults {
+	f := &faults{
+		path:    cfg.FaultPath,
+		percent: cfg.FaultPercent,
+		latency: cfg.FaultLatency,
+		status:  cfg.FaultStatus,
+		drop:    cfg.FaultDrop,
+	}
+	f.enabled.Store(f.configured())
+	return f
+}
+
+// Returns true if there's any fault to inject.
+func (f *faults) configured() bool {
+	return f.latency > 0 || f.status > 0 || f.drop
+}
+
+// Enables or disables the faults, returns whether they're enabled.
+func (f *faults) toggle() bool {
+	enabled := !f.enabled.Load() && f.configured()
+	f.enabled.Store(enabled)
+	return enabled
+}
+
+// Injects the faults if the request is picked. It waits the latency, and
+// responds with the error status, or marks the connection to be dropped.
+// Returns true if the request was handled, and it shouldn't be proxied.
+func (f *faults) inject(rw *responseRecorder, req *http.Request) bool {
+	if !f.enabled.Load() || !f.matches(req) {
+		return false
+	}
+
+	var injected []string
+	defer func() { rw.fault = strings.Join(injected, "+") }()
+	if f.latency > 0 {
+		injected = append(injected, "latency")
+		select {
+		case <-time.After(f.latency):
+		case <-req.Context().Done():
+			rw.status = statusClientClosed
+			return true
+		}
+	}
+	switch {
+	case f.drop:
+		injected = append(injected, "drop")
+		// Logged as a bad gateway, as the client gets no response.
+		rw.status = http.StatusBadGateway
+		return true
+	case f.status > 0:
+		injected = append(injected, "error")
+		http.Error(rw, http.StatusText(f.status), f.status)
+		return true
+	}
+	return false
+}
+
+// Returns true if the request matches the path, and it's in the percentage.
+func (f *faults) matches(req *http.Request) bool {
+	if len(f.path) > 0 {
+		if ok, _ := path.Match(f.path, req.URL.Path); !ok {
+			return false
+		}
+	}
+	return rand.Intn(100) < f.percent
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// The gRPC status codes, by their number.
+var grpcCodes = []string{
+	"OK",
+	"CANCELLED",
+	"UNKNOWN",
+	"INVALID_ARGUMENT",
+	"DEADLINE_EXCEEDED",
+	"NOT_FOUND",
+	"ALREADY_EXISTS",
+	"PERMISSION_DENIED",
+	"RESOURCE_EXHAUSTED",
+	"FAILED_PRECONDITION",
+	"ABORTED",
+	"OUT_OF_RANGE",
+	"UNIMPLEMENTED",
+	"INTERNAL",
+	"UNAVAILABLE",
+	"DATA_LOSS",
+	"UNAUTHENTICATED",
+}
+
+// Returns the method of a gRPC request (i.e., package.Service/Method), and
+// false if it's not a gRPC request.
+func grpcMethod(req *http.Request) (string, bool) {
+	if !strings.HasPrefix(req.Header.Get("Content-Type"), "application/grpc") {
+		return "", false
+	}
+	return strings.TrimPrefix(req.URL.Path, "/"), true
+}
+
+// Returns the gRPC status code of the response, from the trailers copied by
+// the reverse proxy, or from the headers of a trailers-only response.
+func grpcStatus(h http.Header) (int, bool) {
+	status := h.Get("Grpc-Status")
+	if len(status) == 0 {
+		status = h.Get(http.TrailerPrefix + "Grpc-Status")
+	}
+	code, err := strconv.Atoi(status)
+	return code, err == nil
+}
+
+func grpcCodeName(code int) string {
+	if code >= 0 && code < len(grpcCodes) {
+		return grpcCodes[code]
+	}
+	return fmt.Sprint(code)
+}
+
+// Returns true if the code is a server error, the ones mapped to a 5xx
+// status: UNKNOWN, DEADLINE_EXCEEDED, UNIMPLEMENTED, INTERNAL, UNAVAILABLE,
+// and DATA_LOSS.
+func grpcServerError(code int) bool {
+	switch code {
+	case 2, 4, 12, 13, 14, 15:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// headerRule sets a header, or removes it.
+type headerRule struct {
+	name   string
+	value  string
+	remove bool
+}
+
+// Returns an error if any of the header rules is invalid.
+func ValidateHeaderRules(rules []string) error {
+	_, err := parseHeaderRules(rules)
+	return err
+}
+
+// Parses the header rules, either "Name: value" to set a header, or "-Name"
+// to remove it.
+func parseHeaderRules(rules []string) ([]headerRule, error) {
+	parsed := make([]headerRule, 0, len(rules))
+	for _, rule := range rules {
+		if name, ok := strings.CutPrefix(rule, "-"); ok {
+			if len(strings.TrimSpace(name)) == 0 {
+				return nil, fmt.Errorf("invalid header rule %q, missing the header name", rule)
+			}
+			parsed = append(parsed, headerRule{name: strings.TrimSpace(name), remove: true})
+			continue
+		}
+		name, value, ok := strings.Cut(rule, ":")
+		if !ok || len(strings.TrimSpace(name)) == 0 {
+			return nil, fmt.Errorf("invalid header rule %q, it needs to be either 'Name: value', or '-Name'", rule)
+		}
+		parsed = append(parsed, headerRule{name: strings.TrimSpace(name), value: strings.TrimSpace(value)})
+	}
+	return parsed, nil
+}
+
+func applyHeaderRules(h http.Header, rules []headerRule) {
+	for _, r := range rules {
+		if r.remove {
+			h.Del(r.name)
+		} else {
+			h.Set(r.name, r.value)
+		}
+	}
+}
+
+// Sets the X-Forwarded-Host and X-Forwarded-Proto headers to the public host
+// and scheme, replacing the ones sent by the client, as the response headers
+// are rewritten with them. X-Forwarded-For is set by the reverse proxy.
+func setForwardedHeaders(req *http.Request, publicURL string) {
+	scheme := "http"
+	if u, err := url.Parse(publicURL); err == nil && len(u.Scheme) > 0 {
+		scheme = u.Scheme
+	}
+	req.Header.Set("X-Forwarded-Host", req.Host)
+	req.Header.Set("X-Forwarded-Proto", scheme)
+}
+
+// Rewrites the Location and Set-Cookie headers pointing to the local server,
+// so redirects and cookies use the public host.
+func rewriteLocalHeaders(res *http.Response, localHost string) {
+	publicHost := res.Request.Header.Get("X-Forwarded-Host")
+	publicScheme := res.Request.Header.Get("X-Forwarded-Proto")
+	if len(publicHost) == 0 {
+		return
+	}
+
+	if location := res.Header.Get("Location"); len(location) > 0 {
+		if u, err := url.Parse(location); err == nil && isLocalHost(u.Host, localHost) {
+			u.Scheme, u.Host = publicScheme, publicHost
+			res.Header.Set("Location", u.String())
+		}
+	}
+
+	publicDomain := publicHost
+	if host, _, err := net.SplitHostPort(publicHost); err == nil {
+		publicDomain = host
+	}
+	cookies := append([]string(nil), res.Header.Values("Set-Cookie")...)
+	for i, cookie := range cookies {
+		attrs := strings.Split(cookie, ";")
+		for j, attr := range attrs {
+			name, value, _ := strings.Cut(strings.TrimSpace(attr), "=")
+			if strings.EqualFold(name, "domain") && isLocalHost(strings.TrimPrefix(value, "."), localHost) {
+				attrs[j] = " Domain=" + publicDomain
+			}
+		}
+		cookies[i] = strings.Join(attrs, ";")
+	}
+	if len(cookies) > 0 {
+		res.Header["Set-Cookie"] = cookies
+	}
+}
+
+// Returns true if host (with or without port) is the local server's host, or
+// a loopback address. If localHost has no port, as when the upstream is a unix
+// socket, the local server can be behind any port, so every port matches.
+func isLocalHost(host, localHost string) bool {
+	if len(host) == 0 {
+		return false
+	}
+	if host == localHost {
+		return true
+	}
+	localName, localPort, err := net.SplitHostPort(localHost)
+	if err != nil {
+		localName, localPort = localHost, ""
+	}
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		name, port = host, localPort
+	}
+	if len(localPort) > 0 && port != localPort {
+		return false
+	}
+	if name == localName || name == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(name)
+	return ip != nil && ip.IsLoopback()
+}
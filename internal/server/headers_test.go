@@ -0,0 +1,128 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsLocalHost(t *testing.T) {
+	tests := []struct {
+		host, localHost string
+		want            bool
+	}{
+		{"localhost:3000", "localhost:3000", true},
+		{"localhost", "localhost:3000", true},
+		{"127.0.0.1:3000", "localhost:3000", true},
+		{"[::1]:3000", "localhost:3000", true},
+		{"0.0.0.0:3000", "0.0.0.0:3000", true},
+		{"localhost:3001", "localhost:3000", false},
+		{"example.com:3000", "localhost:3000", false},
+		{"", "localhost:3000", false},
+		// The upstream is a unix socket.
+		{"localhost:3000", "localhost", true},
+		{"127.0.0.1:8080", "localhost", true},
+		{"localhost", "localhost", true},
+		{"example.com", "localhost", false},
+	}
+	for _, tt := range tests {
+		if got := isLocalHost(tt.host, tt.localHost); got != tt.want {
+			t.Errorf("isLocalHost(%q, %q) = %v, want %v", tt.host, tt.localHost, got, tt.want)
+		}
+	}
+}
+
+func TestRewriteLocalHeaders(t *testing.T) {
+	tests := []struct {
+		name          string
+		localHost     string
+		forwardedHost string
+		location      string
+		cookies       []string
+		wantLocation  string
+		wantCookies   []string
+	}{
+		{
+			name:          "location",
+			localHost:     "localhost:3000",
+			location:      "http://localhost:3000/login?next=%2F",
+			wantLocation:  "https://abc.loca.lt/login?next=%2F",
+			forwardedHost: "abc.loca.lt",
+		},
+		{
+			name:          "relative location",
+			localHost:     "localhost:3000",
+			location:      "/login",
+			wantLocation:  "/login",
+			forwardedHost: "abc.loca.lt",
+		},
+		{
+			name:          "other host",
+			localHost:     "localhost:3000",
+			location:      "https://example.com/",
+			wantLocation:  "https://example.com/",
+			forwardedHost: "abc.loca.lt",
+		},
+		{
+			name:          "socket upstream",
+			localHost:     "localhost",
+			location:      "http://localhost:3000/",
+			wantLocation:  "https://abc.loca.lt/",
+			forwardedHost: "abc.loca.lt",
+		},
+		{
+			name:      "cookies",
+			localHost: "localhost:3000",
+			cookies: []string{
+				"session=1; Domain=localhost; Path=/",
+				"theme=dark; domain=.127.0.0.1",
+				"other=1; Domain=example.com",
+				"plain=1",
+			},
+			wantCookies: []string{
+				"session=1; Domain=abc.loca.lt; Path=/",
+				"theme=dark; Domain=abc.loca.lt",
+				"other=1; Domain=example.com",
+				"plain=1",
+			},
+			forwardedHost: "abc.loca.lt:443",
+		},
+		{
+			name:         "no forwarded host",
+			localHost:    "localhost:3000",
+			location:     "http://localhost:3000/",
+			wantLocation: "http://localhost:3000/",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if len(tt.forwardedHost) > 0 {
+				req.Header.Set("X-Forwarded-Host", tt.forwardedHost)
+				req.Header.Set("X-Forwarded-Proto", "https")
+			}
+			res := &http.Response{Header: http.Header{}, Request: req}
+			if len(tt.location) > 0 {
+				res.Header.Set("Location", tt.location)
+			}
+			for _, c := range tt.cookies {
+				res.Header.Add("Set-Cookie", c)
+			}
+
+			rewriteLocalHeaders(res, tt.localHost)
+
+			if got := res.Header.Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+			got := res.Header.Values("Set-Cookie")
+			if len(got) != len(tt.wantCookies) {
+				t.Fatalf("Set-Cookie = %q, want %q", got, tt.wantCookies)
+			}
+			for i := range got {
+				if got[i] != tt.wantCookies[i] {
+					t.Errorf("Set-Cookie[%d] = %q, want %q", i, got[i], tt.wantCookies[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ivanvc/tube/internal/config"
+)
+
+const (
+	rateLimit = "rate"
+	bodyLimit = "body"
+
+	// The interval to remove the buckets of the clients that went quiet.
+	bucketsCleanupInterval = time.Minute
+)
+
+// limits enforces the per-client rate limit, with a token bucket for every
+// client IP, and the maximum request body size.
+type limits struct {
+	rate        float64
+	burst       float64
+	maxBodySize int64
+	// Whether the client IP is the one added by the tunnel server to
+	// X-Forwarded-For, as the connections come from the tunnel.
+	forwarded bool
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	cleanedAt time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newLimits(cfg *config.Config) *limits {
+	burst := cfg.RateLimitBurst
+	if burst <= 0 {
+		burst = cfg.RateLimit
+	}
+	return &limits{
+		rate:        float64(cfg.RateLimit),
+		burst:       float64(burst),
+		maxBodySize: int64(cfg.MaxBodySize) * 1024 * 1024,
+		forwarded:   cfg.Provider == "localtunnel",
+		buckets:     make(map[string]*bucket),
+		cleanedAt:   time.Now(),
+	}
+}
+
+// Responds with 429 if the client exceeded the rate limit, or with 413 if
+// the body is larger than the maximum, and returns the exceeded limit.
+// Otherwise, it limits the body, returns an empty string, and the request can
+// be proxied.
+func (l *limits) check(rw *responseRecorder, req *http.Request) string {
+	if wait, ok := l.allow(l.client(req), time.Now()); !ok {
+		rw.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+		http.Error(rw, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		return rateLimit
+	}
+	if l.maxBodySize <= 0 || req.Body == nil {
+		return ""
+	}
+	if req.ContentLength > l.maxBodySize {
+		http.Error(rw, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return bodyLimit
+	}
+	req.Body = &limitedBody{ReadCloser: req.Body, limit: l.maxBodySize, remaining: l.maxBodySize}
+	return ""
+}
+
+// Returns the client IP to rate limit. Unlike the logged one, it can't be
+// spoofed: it's the last X-Forwarded-For entry, appended by the tunnel
+// server, or the remote address.
+func (l *limits) client(req *http.Request) string {
+	if values := req.Header.Values("X-Forwarded-For"); l.forwarded && len(values) > 0 {
+		xff := values[len(values)-1]
+		return strings.TrimSpace(xff[strings.LastIndex(xff, ",")+1:])
+	}
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
+
+// Takes a token from the client's bucket at now. If it's empty, returns
+// false, and the time until the next token.
+func (l *limits) allow(client string, now time.Time) (time.Duration, bool) {
+	if l.rate <= 0 {
+		return 0, true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.cleanedAt) >= bucketsCleanupInterval {
+		l.cleanup(now)
+	}
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / l.rate * float64(time.Second)), false
+	}
+	b.tokens--
+	return 0, true
+}
+
+// Removes the buckets that are full again, as they're the same as a new one.
+func (l *limits) cleanup(now time.Time) {
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+	l.cleanedAt = now
+}
+
+// limitedBody fails once the body is larger than the maximum, while it's
+// proxied.
+type limitedBody struct {
+	io.ReadCloser
+	limit     int64
+	remaining int64
+	exceeded  atomic.Bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, &http.MaxBytesError{Limit: b.limit}
+	}
+	// Read one more byte than the remaining, to detect a larger body.
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if b.remaining -= int64(n); b.remaining < 0 {
+		b.exceeded.Store(true)
+		return n + int(b.remaining), &http.MaxBytesError{Limit: b.limit}
+	}
+	return n, err
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ivanvc/tube/internal/config"
+)
+
+func TestLimitsAllow(t *testing.T) {
+	type attempt struct {
+		after time.Duration
+		ok    bool
+		wait  time.Duration
+	}
+	tests := []struct {
+		name     string
+		rate     int
+		burst    int
+		attempts []attempt
+	}{
+		{"disabled", 0, 0, []attempt{{0, true, 0}, {0, true, 0}, {0, true, 0}}},
+		{"burst defaults to rate", 2, 0, []attempt{
+			{0, true, 0},
+			{0, true, 0},
+			{0, false, 500 * time.Millisecond},
+		}},
+		{"burst", 1, 3, []attempt{
+			{0, true, 0},
+			{0, true, 0},
+			{0, true, 0},
+			{0, false, time.Second},
+			{250 * time.Millisecond, false, 750 * time.Millisecond},
+		}},
+		{"refill", 2, 2, []attempt{
+			{0, true, 0},
+			{0, true, 0},
+			{0, false, 500 * time.Millisecond},
+			{500 * time.Millisecond, true, 0},
+			{0, false, 500 * time.Millisecond},
+		}},
+		{"refill up to the burst", 10, 2, []attempt{
+			{0, true, 0},
+			{0, true, 0},
+			{time.Hour, true, 0},
+			{0, true, 0},
+			{0, false, 100 * time.Millisecond},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLimits(&config.Config{RateLimit: tt.rate, RateLimitBurst: tt.burst})
+			now := l.cleanedAt
+			for i, a := range tt.attempts {
+				now = now.Add(a.after)
+				wait, ok := l.allow("192.0.2.1", now)
+				if ok != a.ok || wait != a.wait {
+					t.Errorf("attempt %d: got %v (wait %s), want %v (wait %s)", i, ok, wait, a.ok, a.wait)
+				}
+			}
+		})
+	}
+}
+
+func TestLimitsClientsAndCleanup(t *testing.T) {
+	l := newLimits(&config.Config{RateLimit: 1})
+	now := l.cleanedAt
+	if _, ok := l.allow("192.0.2.1", now); !ok {
+		t.Fatal("first request of 192.0.2.1 was limited")
+	}
+	if _, ok := l.allow("192.0.2.1", now); ok {
+		t.Fatal("second request of 192.0.2.1 wasn't limited")
+	}
+	if _, ok := l.allow("192.0.2.2", now); !ok {
+		t.Fatal("192.0.2.2 shares the bucket of 192.0.2.1")
+	}
+	// The buckets are full again after the cleanup interval.
+	if _, ok := l.allow("192.0.2.3", now.Add(bucketsCleanupInterval)); !ok {
+		t.Fatal("first request of 192.0.2.3 was limited")
+	}
+	if _, ok := l.buckets["192.0.2.1"]; ok {
+		t.Error("the bucket of 192.0.2.1 wasn't removed")
+	}
+	if _, ok := l.buckets["192.0.2.3"]; !ok {
+		t.Error("the bucket of 192.0.2.3 was removed")
+	}
+}
+
+func TestLimitsClient(t *testing.T) {
+	tests := []struct {
+		name       string
+		provider   string
+		remoteAddr string
+		xff        []string
+		want       string
+	}{
+		{"remote address", "ssh", "192.0.2.1:1234", nil, "192.0.2.1"},
+		{"forwarded ignored", "ssh", "192.0.2.1:1234", []string{"198.51.100.1"}, "192.0.2.1"},
+		{"forwarded", "localtunnel", "127.0.0.1:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed entry", "localtunnel", "127.0.0.1:1234", []string{"10.0.0.1, 198.51.100.1"}, "198.51.100.1"},
+		{"spoofed header", "localtunnel", "127.0.0.1:1234", []string{"10.0.0.1", "198.51.100.1"}, "198.51.100.1"},
+		{"not forwarded", "localtunnel", "127.0.0.1:1234", nil, "127.0.0.1"},
+		{"no port", "local", "192.0.2.1", nil, "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLimits(&config.Config{Provider: tt.provider})
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.xff {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			if got := l.client(req); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ivanvc/tube/internal/log"
+)
+
+// mock is a canned response for the requests matching its method and path.
+type mock struct {
+	// The method to match, any if it's empty or "*".
+	Method string `json:"method"`
+	// The path pattern to match, as in path.Match, i.e., /api/users/*.
+	Path    string            `json:"path"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+	// A file with the body, relative to the mocks file.
+	BodyFile string `json:"body_file"`
+	// The time to wait before responding, i.e., 500ms.
+	Delay string `json:"delay"`
+
+	delay time.Duration
+}
+
+// mocks serves the canned responses from a JSON file, it's loaded again
+// once it's modified.
+type mocks struct {
+	file   string
+	logger log.Logger
+
+	mu      sync.Mutex
+	mocks   []mock
+	modTime time.Time
+}
+
+// Returns an error if the mocks file can't be loaded.
+func ValidateMocks(file string) error {
+	_, err := loadMocks(file)
+	return err
+}
+
+func newMocks(file string, logger log.Logger) *mocks {
+	m := &mocks{file: file, logger: logger}
+	if len(file) > 0 {
+		// The file is validated when loading the configuration.
+		m.mocks, _ = loadMocks(file)
+		if info, err := os.Stat(file); err == nil {
+			m.modTime = info.ModTime()
+		}
+	}
+	return m
+}
+
+// Returns the mock for the request, nil if there's none.
+func (m *mocks) match(req *http.Request) *mock {
+	if len(m.file) == 0 {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reload()
+	for i := range m.mocks {
+		mk := &m.mocks[i]
+		if len(mk.Method) > 0 && mk.Method != "*" && !strings.EqualFold(mk.Method, req.Method) {
+			continue
+		}
+		if ok, _ := path.Match(mk.Path, req.URL.Path); ok {
+			return mk
+		}
+	}
+	return nil
+}
+
+// Loads the mocks again if the file was modified, keeping the previous ones
+// if it's invalid.
+func (m *mocks) reload() {
+	info, err := os.Stat(m.file)
+	if err != nil || info.ModTime().Equal(m.modTime) {
+		return
+	}
+	m.modTime = info.ModTime()
+	loaded, err := loadMocks(m.file)
+	if err != nil {
+		m.logger.Log().Error("error reloading mocks", "file", m.file, "error", err)
+		return
+	}
+	m.mocks = loaded
+	m.logger.Log().Info("mocks reloaded", "file", m.file, "mocks", len(loaded))
+}
+
+// Responds with the mock, after its delay.
+func (m *mocks) serve(w *responseRecorder, req *http.Request, mk *mock) {
+	body := []byte(mk.Body)
+	if len(mk.BodyFile) > 0 {
+		var err error
+		if body, err = os.ReadFile(m.bodyPath(mk)); err != nil {
+			m.logger.Log().Error("error reading mock body", "file", mk.BodyFile, "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if mk.delay > 0 {
+		select {
+		case <-time.After(mk.delay):
+		case <-req.Context().Done():
+			w.status = statusClientClosed
+			return
+		}
+	}
+	for name, value := range mk.Headers {
+		w.Header().Set(name, value)
+	}
+	status := mk.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// Returns the path of the mock's body file, relative to the mocks file.
+func (m *mocks) bodyPath(mk *mock) string {
+	if filepath.IsAbs(mk.BodyFile) {
+		return mk.BodyFile
+	}
+	return filepath.Join(filepath.Dir(m.file), mk.BodyFile)
+}
+
+func loadMocks(file string) ([]mock, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var loaded []mock
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", file, err)
+	}
+	for i := range loaded {
+		mk := &loaded[i]
+		if _, err := path.Match(mk.Path, "/"); err != nil || len(mk.Path) == 0 {
+			return nil, fmt.Errorf("invalid path pattern %q", mk.Path)
+		}
+		if len(mk.Delay) > 0 {
+			if mk.delay, err = time.ParseDuration(mk.Delay); err != nil {
+				return nil, fmt.Errorf("invalid delay %q of %s", mk.Delay, mk.Path)
+			}
+		}
+	}
+	return loaded, nil
+}
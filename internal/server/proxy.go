@@ -1,36 +1,222 @@
 package server
 
 import (
-	"fmt"
+	"bufio"
+	"context"
+	"mime"
+	"net"
 	"net/http"
 	"net/http/httputil"
+	"strings"
+	"time"
 
 	"github.com/ivanvc/tube/internal/config"
 	"github.com/ivanvc/tube/internal/log"
 )
 
+// The interval to flush the response to the client while copying it, event
+// streams are flushed after every write.
+const flushInterval = 100 * time.Millisecond
+
+// The status of the requests closed by the client before responding, as
+// nginx logs them.
+const statusClientClosed = 499
+
+type recorderKey struct{}
+
 type proxy struct {
 	httputil.ReverseProxy
-	cfg    *config.Config
-	logger log.Logger
+	cfg             *config.Config
+	logger          log.Logger
+	accessLog       *accessLog
+	stats           *Stats
+	limits          *limits
+	mocks           *mocks
+	faults          *faults
+	static          *staticServer
+	requestHeaders  []headerRule
+	responseHeaders []headerRule
+	// Returns the public URL of the tunnel.
+	publicURL func() string
 }
 
-func newProxy(cfg *config.Config, logger log.Logger) *proxy {
-	p := &proxy{cfg: cfg, logger: logger}
+func newProxy(cfg *config.Config, logger log.Logger, stats *Stats, faults *faults, publicURL func() string) *proxy {
+	p := &proxy{
+		cfg:       cfg,
+		logger:    logger,
+		accessLog: newAccessLog(cfg, logger),
+		stats:     stats,
+		limits:    newLimits(cfg),
+		mocks:     newMocks(cfg.Mocks, logger),
+		faults:    faults,
+		static:    newStaticServer(cfg, stats),
+		publicURL: publicURL,
+	}
+	// The rules are validated when loading the configuration.
+	p.requestHeaders, _ = parseHeaderRules(cfg.RequestHeaders)
+	p.responseHeaders, _ = parseHeaderRules(cfg.ResponseHeaders)
+	p.Transport = newTransport(cfg)
 	p.ReverseProxy.ErrorLog = logger.GetStandardLogWithErrorLevel()
+	p.ErrorHandler = p.handleError
 	p.Director = p.getDirector
+	p.ModifyResponse = p.modifyResponse
+	p.FlushInterval = flushInterval
 	return p
 }
 
-func (p *proxy) getDirector(req *http.Request) {
-	defer func() {
-		path := req.URL.Path
-		if len(req.URL.RawQuery) > 0 {
-			path += fmt.Sprintf("?%s", req.URL.RawQuery)
+// ServeHTTP implements http.Handler. It proxies the request (or serves the
+// static directory), unless it exceeds a limit, a fault is injected, or it
+// matches a mock, and logs it once it's completed.
+func (p *proxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	rw := &responseRecorder{ResponseWriter: w}
+	p.stats.begin(req)
+	if rw.limit = p.limits.check(rw, req); len(rw.limit) == 0 && !p.faults.inject(rw, req) {
+		if mk := p.mocks.match(req); mk != nil {
+			rw.mocked = true
+			p.mocks.serve(rw, req, mk)
+		} else if p.static != nil {
+			p.static.serve(rw, req)
+		} else {
+			p.ReverseProxy.ServeHTTP(rw, req.WithContext(context.WithValue(req.Context(), recorderKey{}, rw)))
 		}
-		p.logger.Log().Infof("%s %s", req.Method, path)
-	}()
+	}
+	duration := time.Since(start)
+	p.stats.end(rw, duration)
+	p.accessLog.log(req, rw, duration)
+	if strings.HasSuffix(rw.fault, "drop") {
+		// Closes the connection without a response.
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// Rewrites the response headers, and detects upgraded connections (i.e.,
+// websockets) and event streams, to track them until they're closed.
+func (p *proxy) modifyResponse(res *http.Response) error {
+	rewriteLocalHeaders(res, p.cfg.ListenHostWithPort())
+	applyHeaderRules(res.Header, p.responseHeaders)
+
+	rw, ok := res.Request.Context().Value(recorderKey{}).(*responseRecorder)
+	if !ok {
+		return nil
+	}
+	var kind string
+	if res.StatusCode == http.StatusSwitchingProtocols {
+		kind = strings.ToLower(res.Header.Get("Upgrade"))
+		// The upgrade response is written to the hijacked connection.
+		rw.status = res.StatusCode
+	} else if mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); mediaType == "text/event-stream" {
+		kind = sseStream
+	} else {
+		return nil
+	}
+	rw.stream = &stream{kind: kind}
+	p.stats.streamOpened(kind)
+	p.accessLog.logOpen(res.Request, kind)
+	return nil
+}
 
+func (p *proxy) getDirector(req *http.Request) {
 	req.URL.Scheme = p.cfg.ListenScheme
 	req.URL.Host = p.cfg.ListenHostWithPort()
+	setForwardedHeaders(req, p.publicURL())
+	if p.cfg.HostHeader == "local" {
+		req.Host = p.cfg.ListenHostWithPort()
+	}
+	applyHeaderRules(req.Header, p.requestHeaders)
+}
+
+// Records the upstream error to log it with the request, and responds with a
+// bad gateway status, or with 413 if the body was larger than the maximum.
+func (p *proxy) handleError(w http.ResponseWriter, req *http.Request, err error) {
+	rw, _ := w.(*responseRecorder)
+	if body, ok := req.Body.(*limitedBody); ok && body.exceeded.Load() {
+		if rw != nil {
+			rw.limit = bodyLimit
+		}
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	if rw != nil {
+		rw.err = err
+	}
+	w.WriteHeader(http.StatusBadGateway)
+}
+
+// responseRecorder records the status and size of the response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+	err    error
+	stream *stream
+	// The limit the request exceeded, if any.
+	limit string
+	// Whether a mock served the response.
+	mocked bool
+	// The injected faults, if any.
+	fault string
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	// Ignore informational responses, other than switching protocols.
+	if r.status == 0 && (status >= http.StatusOK || status == http.StatusSwitchingProtocols) {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	if r.stream != nil && r.stream.kind == sseStream {
+		r.stream.writeEvents(b[:n])
+		r.Flush()
+	}
+	return n, err
+}
+
+// Flush implements http.Flusher.
+func (r *responseRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker. The connection of an upgraded response
+// is wrapped to count its traffic.
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(r.ResponseWriter).Hijack()
+	if err != nil || r.stream == nil {
+		return conn, brw, err
+	}
+	return &streamConn{Conn: conn, stream: r.stream}, brw, nil
+}
+
+// Unwrap returns the underlying http.ResponseWriter, used by
+// http.ResponseController.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Returns the bytes written to the client, including the ones written to an
+// upgraded connection.
+func (r *responseRecorder) BytesOut() int64 {
+	if r.stream == nil {
+		return r.bytes
+	}
+	r.stream.mu.Lock()
+	defer r.stream.mu.Unlock()
+	return r.bytes + r.stream.bytesOut
+}
+
+// Returns the status of the response.
+func (r *responseRecorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
 }
@@ -1,55 +1,213 @@
 package server
 
 import (
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 
 	"github.com/ivanvc/tube/internal/config"
 	"github.com/ivanvc/tube/internal/log"
-	"github.com/localtunnel/go-localtunnel"
+	"github.com/ivanvc/tube/internal/tunnel"
 )
 
+// The maximum time between attempts to reconnect the tunnel.
+const maxReconnectDelay = 30 * time.Second
+
+// listenerServer serves the connections of the tunnel listener, either the
+// HTTP server with the reverse proxy, or the tcpServer.
+type listenerServer interface {
+	Serve(net.Listener) error
+	Close() error
+}
+
 type Server struct {
-	cfg      *config.Config
-	logger   log.Logger
-	server   *http.Server
-	listener *localtunnel.Listener
+	cfg    *config.Config
+	logger log.Logger
+	server listenerServer
+	tunnel tunnel.Tunnel
+	stats  *Stats
+	faults *faults
+	// The reverse proxy, nil in the tcp mode.
+	proxy *proxy
+
+	mu       sync.Mutex
+	listener net.Listener
+	url      string
+	closed   bool
 }
 
-// Returns a new Server with the reverse proxy
-func New(cfg *config.Config, logger log.Logger) *Server {
-	server := &http.Server{
-		Handler:  newProxy(cfg, logger),
-		ErrorLog: logger.GetStandardLogWithErrorLevel(),
+// Returns a new Server with the reverse proxy, or piping the connections in
+// the tcp mode, the requests are logged to requestLogger.
+func New(cfg *config.Config, logger, requestLogger log.Logger) *Server {
+	var maxConns int
+	if cfg.Provider == "localtunnel" {
+		maxConns = cfg.MaxConnections
 	}
-
-	return &Server{cfg: cfg, logger: logger, server: server}
+	stats := newStats(maxConns)
+	s := &Server{cfg: cfg, logger: logger, stats: stats, faults: newFaults(cfg)}
+	if cfg.Mode == "tcp" {
+		s.server = newTCPServer(cfg, requestLogger, stats)
+		return s
+	}
+	s.proxy = newProxy(cfg, requestLogger, stats, s.faults, s.ListenerAddr)
+	var handler http.Handler = s.proxy
+	if cfg.H2C {
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	}
+	s.server = &http.Server{
+		Handler:   handler,
+		ErrorLog:  logger.GetStandardLogWithErrorLevel(),
+		ConnState: s.connState,
+	}
+	return s
 }
 
-// Starts localtunnel listener.
+// Starts the tunnel listener, returns its public URL.
 func (s *Server) StartListener() (string, error) {
-	s.logger.Log().Infof("forwarding traffic to %s", s.cfg.ListenURL())
-	var err error
-	s.listener, err = localtunnel.Listen(localtunnel.Options{
-		Log:     s.logger.GetStandardLog(),
-		BaseURL: s.cfg.ServerBaseURL,
-	})
-	if err != nil {
-		return "", err
+	if len(s.cfg.Static) > 0 {
+		s.logger.Log().Infof("serving %s", s.cfg.Static)
+	} else {
+		s.logger.Log().Infof("forwarding traffic to %s", s.cfg.ListenURL())
 	}
-	return s.listener.Addr().String(), nil
+	if s.tunnel == nil {
+		var err error
+		if s.tunnel, err = tunnel.New(s.cfg, s.logger); err != nil {
+			return "", err
+		}
+	}
+	return s.connect()
 }
 
-// Serve the Proxy for the listener.
+// Serve the Proxy (or pipe the connections) for the listener. If the tunnel drops, it reconnects,
+// until the server is closed.
 func (s *Server) Serve() error {
-	return s.server.Serve(s.listener)
+	for {
+		s.mu.Lock()
+		listener := s.listener
+		s.mu.Unlock()
+		err := s.server.Serve(listener)
+		if err == http.ErrServerClosed {
+			return nil
+		}
+		s.logger.Log().Warn("tunnel disconnected, reconnecting", "error", err)
+		if !s.reconnect() {
+			return nil
+		}
+	}
 }
 
-// Terminates the HTTP server.
+// Terminates the server, and removes the URL file.
 func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	if len(s.cfg.URLFile) > 0 {
+		os.Remove(s.cfg.URLFile)
+	}
 	return s.server.Close()
 }
 
-// Returns the listener (tunnel) addresss.
+// Returns the listener (tunnel) public URL, empty if the listener didn't
+// start yet.
 func (s *Server) ListenerAddr() string {
-	return s.listener.Addr().String()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.url
+}
+
+// Tracks the connections, and warns when the configured maximum of tunnel
+// connections are busy, as the following requests wait for one to be free.
+func (s *Server) connState(conn net.Conn, state http.ConnState) {
+	if s.stats.connState(conn, state) {
+		s.logger.Log().Warn("all tunnel connections are busy, requests are queueing", "max_connections", s.cfg.MaxConnections)
+	}
+}
+
+func (s *Server) connect() (string, error) {
+	listener, url, err := s.tunnel.Listen()
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	s.listener, s.url = listener, url
+	s.mu.Unlock()
+	if err := s.writeURLFile(url); err != nil {
+		s.logger.Log().Error("error writing URL file", "file", s.cfg.URLFile, "error", err)
+	}
+	return url, nil
+}
+
+// Tries to connect the tunnel again, with an exponential backoff. Returns
+// false if the server was closed meanwhile.
+func (s *Server) reconnect() bool {
+	delay := time.Second
+	for {
+		s.mu.Lock()
+		closed := s.closed
+		s.mu.Unlock()
+		if closed {
+			return false
+		}
+		url, err := s.connect()
+		if err == nil {
+			s.logger.Log().Infof("tunnel reconnected at %s", url)
+			return true
+		}
+		s.logger.Log().Error("error reconnecting tunnel", "error", err, "retry", delay)
+		time.Sleep(delay)
+		if delay *= 2; delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// Writes the URL to the URL file, if set. It's written to a temporary file
+// first, and then renamed, so readers never see a partial URL.
+func (s *Server) writeURLFile(url string) error {
+	if len(s.cfg.URLFile) == 0 {
+		return nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.cfg.URLFile), ".tube-url-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(url + "\n"); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.cfg.URLFile)
+}
+
+// Returns the traffic statistics of the proxy.
+func (s *Server) Stats() StatsSnapshot {
+	snap := s.stats.Snapshot()
+	snap.FaultsConfigured = s.faults.configured()
+	snap.FaultsEnabled = s.faults.enabled.Load()
+	return snap
+}
+
+// Notifies the browsers of the static directory to reload, if it's served.
+func (s *Server) LiveReload() {
+	if s.proxy != nil && s.proxy.static != nil {
+		s.proxy.static.reload()
+	}
+}
+
+// Enables or disables the fault injection, returns whether it's enabled. It
+// stays disabled if there are no faults configured.
+func (s *Server) ToggleFaults() bool {
+	return s.faults.toggle()
 }
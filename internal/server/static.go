@@ -0,0 +1,188 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/ivanvc/tube/internal/config"
+)
+
+// The path of the event stream notifying the browsers to reload.
+const liveReloadPath = "/__tube/livereload"
+
+// The script injected into the HTML responses for the live reload.
+const liveReloadScript = `<script>new EventSource("` + liveReloadPath + `").onmessage = () => location.reload()</script>`
+
+// staticServer serves a directory, instead of proxying the requests. With
+// the live reload, HTML responses get a script that reloads the page once
+// the directory changes.
+type staticServer struct {
+	root       http.FileSystem
+	listing    bool
+	spa        bool
+	liveReload bool
+	stats      *Stats
+
+	mu      sync.Mutex
+	clients map[chan struct{}]struct{}
+}
+
+// Returns a new staticServer, nil if there's no static directory.
+func newStaticServer(cfg *config.Config, stats *Stats) *staticServer {
+	if len(cfg.Static) == 0 {
+		return nil
+	}
+	return &staticServer{
+		root:       http.Dir(cfg.Static),
+		listing:    cfg.StaticListing,
+		spa:        cfg.StaticSPA,
+		liveReload: cfg.WatchForChanges,
+		stats:      stats,
+		clients:    make(map[chan struct{}]struct{}),
+	}
+}
+
+// Serves the file, the index.html of a directory, its listing (if enabled),
+// or the root index.html for the SPA fallback.
+func (s *staticServer) serve(rw *responseRecorder, req *http.Request) {
+	if s.liveReload && req.URL.Path == liveReloadPath {
+		s.serveLiveReload(rw, req)
+		return
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		rw.Header().Set("Allow", "GET, HEAD")
+		http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := path.Clean("/" + req.URL.Path)
+	f, info, err := s.open(name)
+	if err == nil && info.IsDir() {
+		if !strings.HasSuffix(req.URL.Path, "/") {
+			target := path.Base(name) + "/"
+			if len(req.URL.RawQuery) > 0 {
+				target += "?" + req.URL.RawQuery
+			}
+			http.Redirect(rw, req, target, http.StatusMovedPermanently)
+			f.Close()
+			return
+		}
+		index, indexInfo, indexErr := s.open(path.Join(name, "index.html"))
+		switch {
+		case indexErr == nil:
+			f.Close()
+			f, info, name = index, indexInfo, path.Join(name, "index.html")
+		case s.listing:
+			f.Close()
+			rw.Header().Set("Cache-Control", "no-cache")
+			http.FileServer(s.root).ServeHTTP(rw, req)
+			return
+		default:
+			f.Close()
+			err = fs.ErrNotExist
+		}
+	}
+	if err != nil && s.spa && acceptsHTML(req) {
+		f, info, err = s.open("/index.html")
+		name = "/index.html"
+	}
+	if err != nil {
+		http.NotFound(rw, req)
+		return
+	}
+	defer f.Close()
+
+	// Browsers revalidate every response, so they get the changes.
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("ETag", fmt.Sprintf(`W/"%x-%x"`, info.Size(), info.ModTime().UnixNano()))
+	var content io.ReadSeeker = f
+	if s.liveReload && strings.HasPrefix(mime.TypeByExtension(path.Ext(name)), "text/html") {
+		html, err := io.ReadAll(f)
+		if err != nil {
+			http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		content = bytes.NewReader(injectLiveReload(html))
+	}
+	http.ServeContent(rw, req, name, info.ModTime(), content)
+}
+
+func (s *staticServer) open(name string) (http.File, fs.FileInfo, error) {
+	f, err := s.root.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, info, nil
+}
+
+// Keeps an event stream open, and sends an event once the directory
+// changes.
+func (s *staticServer) serveLiveReload(rw *responseRecorder, req *http.Request) {
+	changes := make(chan struct{}, 1)
+	s.mu.Lock()
+	s.clients[changes] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, changes)
+		s.mu.Unlock()
+	}()
+
+	rw.stream = &stream{kind: sseStream}
+	s.stats.streamOpened(sseStream)
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.WriteHeader(http.StatusOK)
+	rw.Flush()
+	for {
+		select {
+		case <-changes:
+			// The recorder flushes every write of an event stream.
+			fmt.Fprint(rw, "data: reload\n\n")
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+// Notifies the browsers to reload.
+func (s *staticServer) reload() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for changes := range s.clients {
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Returns true if the request is for a page, it accepts HTML.
+func acceptsHTML(req *http.Request) bool {
+	return strings.Contains(req.Header.Get("Accept"), "text/html")
+}
+
+// Adds the live reload script before the end of the body, or at the end if
+// there's none.
+func injectLiveReload(html []byte) []byte {
+	i := bytes.LastIndex(bytes.ToLower(html), []byte("</body>"))
+	if i < 0 {
+		return append(html, liveReloadScript...)
+	}
+	injected := make([]byte, 0, len(html)+len(liveReloadScript))
+	injected = append(injected, html[:i]...)
+	injected = append(injected, liveReloadScript...)
+	return append(injected, html[i:]...)
+}
@@ -0,0 +1,268 @@
+package server
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// The number of latencies kept to calculate the percentiles.
+	maxLatencies = 1024
+	// The number of seconds kept for the requests per second history.
+	historySeconds = 60
+	// The number of seconds used to calculate the requests per second rate.
+	rateSeconds = 10
+)
+
+// Stats holds the traffic statistics of the session.
+type Stats struct {
+	mu          sync.Mutex
+	start       time.Time
+	requests    int64
+	statuses    [5]int64
+	latencies   []time.Duration
+	nextLatency int
+	bytesIn     int64
+	bytesOut    int64
+	rateLimited int64
+	tooLarge    int64
+	faults      int64
+	active      int
+	streams     map[string]int
+	conns       map[net.Conn]http.ConnState
+	busy        int
+	maxConns    int
+	saturated   bool
+	history     [historySeconds]int
+	historyAt   int64
+}
+
+// StatsSnapshot is a copy of the statistics at a given time.
+type StatsSnapshot struct {
+	Uptime   time.Duration
+	Requests int64
+	Rate     float64
+	Statuses [5]int64
+	P50      time.Duration
+	P95      time.Duration
+	P99      time.Duration
+	BytesIn  int64
+	BytesOut int64
+	Active   int
+	// The requests rejected by the rate limit, and for their body size.
+	RateLimited int64
+	TooLarge    int64
+	// The requests with injected faults.
+	Faults int64
+	// Whether fault injection is configured, and enabled.
+	FaultsConfigured bool
+	FaultsEnabled    bool
+	// The open websockets and event streams.
+	WebSockets   int
+	EventStreams int
+	// The keep-alive connections, the ones that received a request. The
+	// tunnel's pre-opened sockets are not known until then.
+	Connections int
+	// The connections serving a request, the rest are idle.
+	Busy int
+	// The configured maximum of tunnel connections, the server may allow
+	// fewer. 0 if the tunnel has no pool.
+	MaxConnections int
+	// Requests per second, the oldest first.
+	History []int
+}
+
+func newStats(maxConns int) *Stats {
+	return &Stats{
+		start:     time.Now(),
+		latencies: make([]time.Duration, 0, maxLatencies),
+		streams:   make(map[string]int),
+		conns:     make(map[net.Conn]http.ConnState),
+		maxConns:  maxConns,
+	}
+}
+
+// Returns a snapshot of the statistics.
+func (s *Stats) Snapshot() StatsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshot(time.Now())
+}
+
+func (s *Stats) snapshot(now time.Time) StatsSnapshot {
+	s.advance(now)
+	snap := StatsSnapshot{
+		Uptime:         now.Sub(s.start),
+		Requests:       s.requests,
+		Statuses:       s.statuses,
+		BytesIn:        s.bytesIn,
+		BytesOut:       s.bytesOut,
+		Active:         s.active,
+		RateLimited:    s.rateLimited,
+		TooLarge:       s.tooLarge,
+		Faults:         s.faults,
+		WebSockets:     s.streams[websocketStream],
+		EventStreams:   s.streams[sseStream],
+		Connections:    len(s.conns),
+		Busy:           s.busy,
+		MaxConnections: s.maxConns,
+		History:        make([]int, historySeconds),
+	}
+	for i := range snap.History {
+		snap.History[i] = s.history[(int(s.historyAt)+1+i)%historySeconds]
+	}
+	// Skip the current second, as it's not complete yet.
+	var recent int
+	for _, n := range snap.History[historySeconds-1-rateSeconds : historySeconds-1] {
+		recent += n
+	}
+	snap.Rate = float64(recent) / rateSeconds
+
+	if len(s.latencies) > 0 {
+		sorted := append([]time.Duration(nil), s.latencies...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		snap.P50 = percentile(sorted, 0.50)
+		snap.P95 = percentile(sorted, 0.95)
+		snap.P99 = percentile(sorted, 0.99)
+	}
+	return snap
+}
+
+func (s *Stats) begin(req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active++
+	req.Body = &countingReader{ReadCloser: req.Body, stats: s}
+}
+
+func (s *Stats) streamOpened(kind string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.streams[kind]++
+}
+
+// Tracks a connection piped in the tcp mode.
+func (s *Stats) tcpOpened() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active++
+}
+
+// Counts a closed connection of the tcp mode as a request, without status
+// nor latency.
+func (s *Stats) tcpClosed(bytesIn, bytesOut int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active--
+	s.count(time.Now())
+	s.bytesIn += bytesIn
+	s.bytesOut += bytesOut
+}
+
+func (s *Stats) end(rw *responseRecorder, duration time.Duration) {
+	bytesOut := rw.BytesOut()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.active--
+	s.count(time.Now())
+	if class := rw.Status()/100 - 1; class >= 0 && class < len(s.statuses) {
+		s.statuses[class]++
+	}
+	s.bytesOut += bytesOut
+	switch rw.limit {
+	case rateLimit:
+		s.rateLimited++
+	case bodyLimit:
+		s.tooLarge++
+	}
+	if len(rw.fault) > 0 {
+		s.faults++
+	}
+	if rw.stream != nil {
+		rw.stream.mu.Lock()
+		s.bytesIn += rw.stream.bytesIn
+		rw.stream.mu.Unlock()
+		s.streams[rw.stream.kind]--
+		// Streams last until they're closed, they'd skew the latencies.
+		return
+	}
+	if rw.status == statusClientClosed {
+		// The request didn't complete, its duration is not a latency.
+		return
+	}
+	if len(s.latencies) < maxLatencies {
+		s.latencies = append(s.latencies, duration)
+	} else {
+		s.latencies[s.nextLatency] = duration
+		s.nextLatency = (s.nextLatency + 1) % maxLatencies
+	}
+}
+
+// Tracks the open connections and the ones serving a request, used as
+// http.Server's ConnState. Returns true when the configured maximum of
+// connections become busy.
+func (s *Stats) connState(conn net.Conn, state http.ConnState) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conns[conn] == http.StateActive {
+		s.busy--
+	}
+	switch state {
+	case http.StateHijacked, http.StateClosed:
+		delete(s.conns, conn)
+	default:
+		s.conns[conn] = state
+	}
+	if state == http.StateActive {
+		s.busy++
+	}
+
+	wasSaturated := s.saturated
+	s.saturated = s.maxConns > 0 && s.busy >= s.maxConns
+	return s.saturated && !wasSaturated
+}
+
+// Counts a request finished at now.
+func (s *Stats) count(now time.Time) {
+	s.advance(now)
+	s.requests++
+	s.history[s.historyAt%historySeconds]++
+}
+
+// Moves the history to the current second, clearing the seconds without
+// requests.
+func (s *Stats) advance(now time.Time) {
+	sec := now.Unix()
+	if s.historyAt == 0 {
+		s.historyAt = sec
+		return
+	}
+	if sec-s.historyAt > historySeconds {
+		s.historyAt = sec - historySeconds
+	}
+	for ; s.historyAt < sec; s.historyAt++ {
+		s.history[(s.historyAt+1)%historySeconds] = 0
+	}
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	return sorted[int(float64(len(sorted)-1)*p)]
+}
+
+type countingReader struct {
+	io.ReadCloser
+	stats *Stats
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.stats.mu.Lock()
+	r.stats.bytesIn += int64(n)
+	r.stats.mu.Unlock()
+	return n, err
+}
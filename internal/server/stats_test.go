@@ -0,0 +1,126 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	hundred := make([]time.Duration, 100)
+	for i := range hundred {
+		hundred[i] = time.Duration(i+1) * time.Millisecond
+	}
+	tests := []struct {
+		name   string
+		sorted []time.Duration
+		p      float64
+		want   time.Duration
+	}{
+		{"one", []time.Duration{time.Second}, 0.99, time.Second},
+		{"p50 of two", []time.Duration{time.Second, 2 * time.Second}, 0.50, time.Second},
+		{"p99 of two", []time.Duration{time.Second, 2 * time.Second}, 0.99, time.Second},
+		{"p50", hundred, 0.50, 50 * time.Millisecond},
+		{"p95", hundred, 0.95, 95 * time.Millisecond},
+		{"p99", hundred, 0.99, 99 * time.Millisecond},
+		{"max", hundred, 1, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := percentile(tt.sorted, tt.p); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatsLatencies(t *testing.T) {
+	tests := []struct {
+		name          string
+		record        func(s *Stats)
+		p50, p95, p99 time.Duration
+	}{
+		{"none", func(s *Stats) {}, 0, 0, 0},
+		{"unsorted", func(s *Stats) {
+			for i := 100; i > 0; i-- {
+				s.end(&responseRecorder{}, time.Duration(i)*time.Millisecond)
+			}
+		}, 50 * time.Millisecond, 95 * time.Millisecond, 99 * time.Millisecond},
+		{"rotated", func(s *Stats) {
+			for i := 0; i < maxLatencies; i++ {
+				s.end(&responseRecorder{}, time.Hour)
+			}
+			for i := 0; i < maxLatencies; i++ {
+				s.end(&responseRecorder{}, time.Second)
+			}
+		}, time.Second, time.Second, time.Second},
+		{"partially rotated", func(s *Stats) {
+			for i := 0; i < maxLatencies; i++ {
+				s.end(&responseRecorder{}, time.Hour)
+			}
+			for i := 0; i < maxLatencies/4; i++ {
+				s.end(&responseRecorder{}, time.Second)
+			}
+		}, time.Hour, time.Hour, time.Hour},
+		{"skipped", func(s *Stats) {
+			s.end(&responseRecorder{}, time.Second)
+			s.end(&responseRecorder{status: statusClientClosed}, time.Hour)
+			s.end(&responseRecorder{status: http.StatusSwitchingProtocols, stream: &stream{kind: websocketStream}}, time.Hour)
+		}, time.Second, time.Second, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStats(0)
+			tt.record(s)
+			snap := s.Snapshot()
+			if snap.P50 != tt.p50 || snap.P95 != tt.p95 || snap.P99 != tt.p99 {
+				t.Errorf("got p50 %s, p95 %s, p99 %s, want %s, %s, %s",
+					snap.P50, snap.P95, snap.P99, tt.p50, tt.p95, tt.p99)
+			}
+		})
+	}
+}
+
+func TestStatsHistory(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	tests := []struct {
+		name string
+		// The requests counted at every second after start.
+		requests map[int]int
+		at       int
+		// The expected requests per second, by how many seconds ago.
+		want map[int]int
+		rate float64
+	}{
+		{"current", map[int]int{0: 3}, 0, map[int]int{0: 3}, 0},
+		{"recent", map[int]int{0: 3, 1: 2, 5: 1}, 5, map[int]int{5: 3, 4: 2, 0: 1}, 0.5},
+		{"moved", map[int]int{0: 3, 1: 2}, 30, map[int]int{30: 3, 29: 2}, 0},
+		{"rate window", map[int]int{0: 10, 10: 10, 11: 10}, 11, map[int]int{11: 10, 1: 10, 0: 10}, 1},
+		{"expired", map[int]int{0: 3}, 60, map[int]int{}, 0},
+		{"long gap", map[int]int{0: 3}, 1000, map[int]int{}, 0},
+		{"same slot a minute later", map[int]int{0: 3, 60: 1}, 60, map[int]int{0: 1}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStats(0)
+			for sec := 0; sec <= tt.at; sec++ {
+				for i := 0; i < tt.requests[sec]; i++ {
+					s.count(start.Add(time.Duration(sec) * time.Second))
+				}
+			}
+			snap := s.snapshot(start.Add(time.Duration(tt.at) * time.Second))
+			if len(snap.History) != historySeconds {
+				t.Fatalf("got %d seconds of history, want %d", len(snap.History), historySeconds)
+			}
+			for i, n := range snap.History {
+				ago := historySeconds - 1 - i
+				if n != tt.want[ago] {
+					t.Errorf("%d seconds ago: got %d requests, want %d", ago, n, tt.want[ago])
+				}
+			}
+			if snap.Rate != tt.rate {
+				t.Errorf("got a rate of %v, want %v", snap.Rate, tt.rate)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+)
+
+const (
+	websocketStream = "websocket"
+	sseStream       = "sse"
+)
+
+// stream tracks a long-lived response, either an upgraded connection (i.e.,
+// a websocket), or an event stream (SSE).
+type stream struct {
+	kind string
+
+	mu          sync.Mutex
+	bytesIn     int64
+	bytesOut    int64
+	messagesIn  frameCounter
+	messagesOut frameCounter
+	events      int64
+	last        byte
+	// Whether the current event has any lines.
+	inEvent bool
+}
+
+// Counts the bytes read from the client of an upgraded connection.
+func (s *stream) read(p []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bytesIn += int64(len(p))
+	if s.kind == websocketStream {
+		s.messagesIn.write(p)
+	}
+}
+
+// Counts the bytes written to the client of an upgraded connection.
+func (s *stream) write(p []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bytesOut += int64(len(p))
+	if s.kind == websocketStream {
+		s.messagesOut.write(p)
+	}
+}
+
+// Counts the events of an event stream, each one ends with a blank line.
+// Blank lines without an event before them are skipped.
+func (s *stream) writeEvents(p []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range p {
+		switch b {
+		case '\r':
+			continue
+		case '\n':
+			if s.last == '\n' && s.inEvent {
+				s.events++
+				s.inEvent = false
+			}
+		default:
+			s.inEvent = true
+		}
+		s.last = b
+	}
+}
+
+// streamConn counts the traffic of an upgraded connection.
+type streamConn struct {
+	net.Conn
+	stream *stream
+}
+
+func (c *streamConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.stream.read(p[:n])
+	return n, err
+}
+
+func (c *streamConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.stream.write(p[:n])
+	return n, err
+}
+
+// frameCounter counts the messages of one direction of a websocket, parsing
+// the frame headers, and skipping their payloads.
+type frameCounter struct {
+	header    []byte
+	remaining uint64
+	messages  int64
+}
+
+func (c *frameCounter) write(p []byte) {
+	for len(p) > 0 {
+		if c.remaining > 0 {
+			n := uint64(len(p))
+			if n > c.remaining {
+				n = c.remaining
+			}
+			c.remaining -= n
+			p = p[n:]
+			continue
+		}
+
+		c.header = append(c.header, p[0])
+		p = p[1:]
+		if len(c.header) < 2 || len(c.header) < frameHeaderSize(c.header) {
+			continue
+		}
+		fin, opcode := c.header[0]&0x80 != 0, c.header[0]&0x0f
+		// Control frames (close, ping, and pong) are not messages.
+		if fin && opcode < 0x8 {
+			c.messages++
+		}
+		c.remaining = framePayloadLength(c.header)
+		c.header = c.header[:0]
+	}
+}
+
+// Returns the size of the frame header, from its first two bytes.
+func frameHeaderSize(h []byte) int {
+	size := 2
+	switch h[1] & 0x7f {
+	case 126:
+		size += 2
+	case 127:
+		size += 8
+	}
+	// Masked frame, sent by the client.
+	if h[1]&0x80 != 0 {
+		size += 4
+	}
+	return size
+}
+
+func framePayloadLength(h []byte) uint64 {
+	switch n := h[1] & 0x7f; n {
+	case 126:
+		return uint64(binary.BigEndian.Uint16(h[2:4]))
+	case 127:
+		return binary.BigEndian.Uint64(h[2:10])
+	default:
+		return uint64(n)
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// Returns a websocket frame with the opcode and a payload of size bytes,
+// masked as sent by a client if mask is true.
+func frame(fin bool, opcode byte, size int, mask bool) []byte {
+	b0 := opcode
+	if fin {
+		b0 |= 0x80
+	}
+	var maskBit byte
+	if mask {
+		maskBit = 0x80
+	}
+	f := []byte{b0}
+	switch {
+	case size < 126:
+		f = append(f, maskBit|byte(size))
+	case size <= 0xffff:
+		f = append(f, maskBit|126)
+		f = binary.BigEndian.AppendUint16(f, uint16(size))
+	default:
+		f = append(f, maskBit|127)
+		f = binary.BigEndian.AppendUint64(f, uint64(size))
+	}
+	if mask {
+		f = append(f, 1, 2, 3, 4)
+	}
+	// The payload repeats bytes that look like frame headers.
+	return append(f, bytes.Repeat([]byte{0x81}, size)...)
+}
+
+func TestFrameCounter(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames [][]byte
+		want   int64
+	}{
+		{"text", [][]byte{frame(true, 0x1, 5, false)}, 1},
+		{"masked", [][]byte{frame(true, 0x1, 5, true)}, 1},
+		{"empty", [][]byte{frame(true, 0x2, 0, false)}, 1},
+		{"16 bit length", [][]byte{frame(true, 0x2, 300, true)}, 1},
+		{"64 bit length", [][]byte{frame(true, 0x2, 70000, false)}, 1},
+		{"fragmented", [][]byte{
+			frame(false, 0x1, 10, false),
+			frame(false, 0x0, 10, false),
+			frame(true, 0x0, 10, false),
+		}, 1},
+		{"control", [][]byte{
+			frame(true, 0x9, 4, false),
+			frame(true, 0xa, 4, false),
+			frame(true, 0x8, 2, false),
+		}, 0},
+		{"control between fragments", [][]byte{
+			frame(false, 0x1, 10, true),
+			frame(true, 0x9, 0, true),
+			frame(true, 0x0, 10, true),
+		}, 1},
+		{"several", [][]byte{
+			frame(true, 0x1, 3, false),
+			frame(true, 0x2, 200, false),
+			frame(true, 0x1, 0, false),
+		}, 3},
+	}
+	for _, tt := range tests {
+		data := bytes.Join(tt.frames, nil)
+		for _, chunk := range []int{len(data), 1, 3} {
+			var c frameCounter
+			for p := data; len(p) > 0; {
+				n := chunk
+				if n > len(p) {
+					n = len(p)
+				}
+				c.write(p[:n])
+				p = p[n:]
+			}
+			if c.messages != tt.want {
+				t.Errorf("%s in chunks of %d bytes: got %d messages, want %d", tt.name, chunk, c.messages, tt.want)
+			}
+		}
+	}
+}
+
+func TestStreamWriteEvents(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   int64
+	}{
+		{"one", []string{"data: a\n\n"}, 1},
+		{"several", []string{"data: a\n\nevent: b\ndata: b\n\n"}, 2},
+		{"split", []string{"data: a\n", "\n", "data: b", "\n\n"}, 2},
+		{"crlf", []string{"data: a\r\n\r\n"}, 1},
+		{"extra line feeds", []string{"data: a\n\n\n\n"}, 1},
+		{"unfinished", []string{"data: a\n"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &stream{kind: sseStream}
+			for _, c := range tt.chunks {
+				s.writeEvents([]byte(c))
+			}
+			if s.events != tt.want {
+				t.Errorf("got %d events, want %d", s.events, tt.want)
+			}
+		})
+	}
+}
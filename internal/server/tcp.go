@@ -0,0 +1,163 @@
+package server
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ivanvc/tube/internal/config"
+	"github.com/ivanvc/tube/internal/log"
+)
+
+// The time to wait for the local server to accept a connection.
+const dialTimeout = 10 * time.Second
+
+// tcpServer pipes the tunnel connections byte for byte to the local address,
+// for services that don't speak HTTP.
+type tcpServer struct {
+	cfg    *config.Config
+	logger log.Logger
+	stats  *Stats
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+}
+
+func newTCPServer(cfg *config.Config, logger log.Logger, stats *Stats) *tcpServer {
+	return &tcpServer{
+		cfg:       cfg,
+		logger:    logger,
+		stats:     stats,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// Accepts the connections of the listener, until it fails. Like
+// http.Server, it returns http.ErrServerClosed once the server is closed.
+func (s *tcpServer) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return http.ErrServerClosed
+	}
+	s.listeners[listener] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, listener)
+		s.mu.Unlock()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return http.ErrServerClosed
+			}
+			return err
+		}
+		if !s.track(conn, true) {
+			conn.Close()
+			return http.ErrServerClosed
+		}
+		go s.handle(conn)
+	}
+}
+
+// Closes the listeners and all the open connections.
+func (s *tcpServer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for listener := range s.listeners {
+		listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	return nil
+}
+
+// Adds or removes the connection from the open ones. Returns false if the
+// server is closed.
+func (s *tcpServer) track(conn net.Conn, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !add {
+		delete(s.conns, conn)
+		return true
+	}
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+// Pipes the connection to the local address, and logs it once closed.
+func (s *tcpServer) handle(conn net.Conn) {
+	defer s.track(conn, false)
+	defer conn.Close()
+	start := time.Now()
+	client := conn.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(client); err == nil {
+		client = host
+	}
+
+	network, addr := "tcp", s.cfg.ListenHostWithPort()
+	if len(s.cfg.ListenSocket) > 0 {
+		network, addr = "unix", s.cfg.ListenSocket
+	}
+	upstream, err := net.DialTimeout(network, addr, dialTimeout)
+	if err != nil {
+		s.logger.Log().Error("connection", "client", client, "error", err)
+		return
+	}
+	defer upstream.Close()
+	s.logger.Log().Info("connection", "client", client, "state", "open")
+	s.stats.tcpOpened()
+
+	var bytesIn, bytesOut int64
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		bytesIn = pipe(upstream, conn)
+	}()
+	go func() {
+		defer wg.Done()
+		bytesOut = pipe(conn, upstream)
+	}()
+	wg.Wait()
+
+	duration := time.Since(start)
+	s.stats.tcpClosed(bytesIn, bytesOut)
+	s.logger.Log().Info(
+		"connection",
+		"client", client,
+		"state", "closed",
+		"duration", duration,
+		"bytes_in", bytesIn,
+		"bytes_out", bytesOut,
+	)
+}
+
+// Copies src to dst, and then closes dst for writing, so the other end
+// sees the EOF. Returns the number of bytes copied.
+func pipe(dst, src net.Conn) int64 {
+	n, _ := io.Copy(dst, src)
+	if c, ok := dst.(interface{ CloseWrite() error }); ok {
+		c.CloseWrite()
+	} else {
+		dst.Close()
+	}
+	return n
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"golang.org/x/net/http2"
+
+	"github.com/ivanvc/tube/internal/config"
+)
+
+// Returns an error if the upstream TLS options are invalid, i.e., the CA
+// bundle or the client certificate can't be loaded.
+func ValidateUpstreamTLS(cfg *config.Config) error {
+	_, err := upstreamTLSConfig(cfg)
+	return err
+}
+
+// Returns the TLS configuration to connect to the local server.
+func upstreamTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.UpstreamInsecure,
+		ServerName:         cfg.UpstreamServerName,
+	}
+
+	if len(cfg.UpstreamCA) > 0 {
+		pem, err := os.ReadFile(cfg.UpstreamCA)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.UpstreamCA)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if len(cfg.UpstreamCert) > 0 || len(cfg.UpstreamKey) > 0 {
+		if len(cfg.UpstreamCert) == 0 || len(cfg.UpstreamKey) == 0 {
+			return nil, errors.New("the client certificate needs both -upstream-cert and -upstream-key")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.UpstreamCert, cfg.UpstreamKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// Returns the transport to the local server, with the upstream TLS options,
+// or HTTP/2 cleartext (h2c) if enabled. When forwarding to a socket, it dials
+// the socket for every request.
+func newTransport(cfg *config.Config) http.RoundTripper {
+	var dialer net.Dialer
+	dial := dialer.DialContext
+	if len(cfg.ListenSocket) > 0 {
+		dial = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", cfg.ListenSocket)
+		}
+	}
+	if cfg.H2C {
+		return &http2.Transport{
+			AllowHTTP: true,
+			// Dials a plain connection, as it's used for the http scheme.
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dial(ctx, network, addr)
+			},
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if len(cfg.ListenSocket) > 0 {
+		transport.DialContext = dial
+	}
+	// The options are validated when loading the configuration.
+	if tlsConfig, err := upstreamTLSConfig(cfg); err == nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	return transport
+}
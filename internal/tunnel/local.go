@@ -0,0 +1,99 @@
+package tunnel
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/hashicorp/mdns"
+
+	"github.com/ivanvc/tube/internal/config"
+	"github.com/ivanvc/tube/internal/log"
+)
+
+// localTunnel listens on a local address, without exposing the proxy to the
+// internet, i.e., to reach it from the LAN. Optionally, it advertises itself
+// via mDNS.
+type localTunnel struct {
+	cfg    *config.Config
+	logger log.Logger
+}
+
+// mdnsListener stops advertising the service along with the listener.
+type mdnsListener struct {
+	net.Listener
+	mdns *mdns.Server
+}
+
+func newLocal(cfg *config.Config, logger log.Logger) Tunnel {
+	return &localTunnel{cfg: cfg, logger: logger}
+}
+
+func (t *localTunnel) Listen() (net.Listener, string, error) {
+	listener, err := net.Listen("tcp", t.cfg.LocalAddr)
+	if err != nil {
+		return nil, "", err
+	}
+	addr := listener.Addr().(*net.TCPAddr)
+	ips := lanIPs(addr.IP)
+	for _, ip := range ips {
+		t.logger.Log().Infof("reachable at %s", tunnelURL(t.cfg, ip.String(), addr.Port))
+	}
+	url := tunnelURL(t.cfg, "localhost", addr.Port)
+	if len(ips) > 0 {
+		url = tunnelURL(t.cfg, ips[0].String(), addr.Port)
+	}
+
+	if len(t.cfg.MDNSName) == 0 {
+		return listener, url, nil
+	}
+	host := t.cfg.MDNSName + ".local."
+	service, err := mdns.NewMDNSService(t.cfg.MDNSName, "_http._tcp", "", host, addr.Port, ips, nil)
+	if err == nil {
+		var server *mdns.Server
+		if server, err = mdns.NewServer(&mdns.Config{Zone: service}); err == nil {
+			url = tunnelURL(t.cfg, t.cfg.MDNSName+".local", addr.Port)
+			t.logger.Log().Infof("advertising via mDNS at %s", url)
+			return &mdnsListener{Listener: listener, mdns: server}, url, nil
+		}
+	}
+	t.logger.Log().Error("error advertising via mDNS", "error", err)
+	return listener, url, nil
+}
+
+func (l *mdnsListener) Close() error {
+	l.mdns.Shutdown()
+	return l.Listener.Close()
+}
+
+// Returns the IPv4 addresses the listener is reachable at from the LAN. If
+// it's listening on all the interfaces, the ones of every interface that is
+// up, and not a loopback.
+func lanIPs(ip net.IP) []net.IP {
+	if !ip.IsUnspecified() {
+		return []net.IP{ip}
+	}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var ips []net.IP
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && n.IP.To4() != nil {
+				ips = append(ips, n.IP)
+			}
+		}
+	}
+	return ips
+}
+
+func tunnelURL(cfg *config.Config, host string, port int) string {
+	return fmt.Sprintf("%s://%s", urlScheme(cfg), net.JoinHostPort(host, fmt.Sprint(port)))
+}
@@ -0,0 +1,32 @@
+package tunnel
+
+import (
+	"net"
+
+	"github.com/localtunnel/go-localtunnel"
+
+	"github.com/ivanvc/tube/internal/config"
+	"github.com/ivanvc/tube/internal/log"
+)
+
+// localtunnelTunnel exposes the proxy through a localtunnel server.
+type localtunnelTunnel struct {
+	cfg    *config.Config
+	logger log.Logger
+}
+
+func newLocaltunnel(cfg *config.Config, logger log.Logger) Tunnel {
+	return &localtunnelTunnel{cfg: cfg, logger: logger}
+}
+
+func (t *localtunnelTunnel) Listen() (net.Listener, string, error) {
+	listener, err := localtunnel.Listen(localtunnel.Options{
+		Log:            t.logger.GetStandardLog(),
+		BaseURL:        t.cfg.ServerBaseURL,
+		MaxConnections: t.cfg.MaxConnections,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return listener, listener.URL(), nil
+}
@@ -0,0 +1,164 @@
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/ivanvc/tube/internal/config"
+	"github.com/ivanvc/tube/internal/log"
+)
+
+// The interval between keepalive requests, to detect a dropped connection.
+const sshKeepAliveInterval = 15 * time.Second
+
+// sshTunnel exposes the proxy through a reverse port forwarding (as ssh -R)
+// on a self-hosted server.
+type sshTunnel struct {
+	cfg    *config.Config
+	logger log.Logger
+}
+
+// sshListener closes the SSH connection along with the listener.
+type sshListener struct {
+	net.Listener
+	client *ssh.Client
+}
+
+func newSSH(cfg *config.Config, logger log.Logger) Tunnel {
+	return &sshTunnel{cfg: cfg, logger: logger}
+}
+
+func (t *sshTunnel) Listen() (net.Listener, string, error) {
+	username, addr := parseSSHHost(t.cfg.SSHHost)
+	auth, err := t.authMethods()
+	if err != nil {
+		return nil, "", err
+	}
+	hostKeyCallback, err := knownhosts.New(filepath.Join(homeDir(), ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, "", fmt.Errorf("error loading known hosts: %w", err)
+	}
+
+	t.logger.Log().Infof("connecting to %s", addr)
+	client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         30 * time.Second,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	listener, err := client.Listen("tcp", t.cfg.SSHRemoteAddr)
+	if err != nil {
+		client.Close()
+		return nil, "", fmt.Errorf("error forwarding remote address %s: %w", t.cfg.SSHRemoteAddr, err)
+	}
+	go keepAlive(client)
+
+	url := t.cfg.SSHURL
+	if len(url) == 0 {
+		_, port, _ := net.SplitHostPort(t.cfg.SSHRemoteAddr)
+		host, _, _ := net.SplitHostPort(addr)
+		url = fmt.Sprintf("%s://%s", urlScheme(t.cfg), net.JoinHostPort(host, port))
+	}
+	return &sshListener{Listener: listener, client: client}, url, nil
+}
+
+func (l *sshListener) Close() error {
+	err := l.Listener.Close()
+	l.client.Close()
+	return err
+}
+
+// Returns the authentication methods, the SSH agent's keys and the key file.
+// If the key file is not set, the default ones in ~/.ssh are tried.
+func (t *sshTunnel) authMethods() ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+	if sock, ok := os.LookupEnv("SSH_AUTH_SOCK"); ok {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+
+	keys := []string{t.cfg.SSHKey}
+	if len(t.cfg.SSHKey) == 0 {
+		keys = nil
+		for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			keys = append(keys, filepath.Join(homeDir(), ".ssh", name))
+		}
+	}
+	var signers []ssh.Signer
+	for _, key := range keys {
+		b, err := os.ReadFile(key)
+		if err != nil {
+			if len(t.cfg.SSHKey) > 0 {
+				return nil, fmt.Errorf("error reading SSH key: %w", err)
+			}
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(b)
+		if err != nil {
+			if len(t.cfg.SSHKey) > 0 {
+				return nil, fmt.Errorf("error parsing SSH key: %w", err)
+			}
+			t.logger.Log().Debug("skipping SSH key", "key", key, "error", err)
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+
+	if len(methods) == 0 {
+		return nil, errors.New("no SSH agent or keys available, specify a key with -ssh-key")
+	}
+	return methods, nil
+}
+
+// Closes the connection once the server stops replying keepalive requests,
+// which makes the listener fail.
+func keepAlive(client *ssh.Client) {
+	t := time.NewTicker(sshKeepAliveInterval)
+	defer t.Stop()
+	for range t.C {
+		if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+			client.Close()
+			return
+		}
+	}
+}
+
+// Parses an [user@]host[:port] string, defaulting to the current user, and
+// port 22.
+func parseSSHHost(s string) (string, string) {
+	var username string
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		username, s = s[:i], s[i+1:]
+	} else if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+	if _, _, err := net.SplitHostPort(s); err != nil {
+		s = net.JoinHostPort(s, "22")
+	}
+	return username, s
+}
+
+func homeDir() string {
+	dir, err := os.UserHomeDir()
+	if err != nil {
+		return "."
+	}
+	return dir
+}
@@ -0,0 +1,47 @@
+package tunnel
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/ivanvc/tube/internal/config"
+	"github.com/ivanvc/tube/internal/log"
+)
+
+// Tunnel exposes the proxy publicly.
+type Tunnel interface {
+	// Establishes the tunnel, returns a listener for the incoming connections
+	// and the public URL. Closing the listener closes the tunnel, and once the
+	// tunnel drops, Accept fails, so Listen can be called again to reconnect.
+	Listen() (net.Listener, string, error)
+}
+
+// The available providers.
+var providers = map[string]func(cfg *config.Config, logger log.Logger) Tunnel{
+	"localtunnel": newLocaltunnel,
+	"ssh":         newSSH,
+	"local":       newLocal,
+}
+
+// Returns true if the provider exists.
+func ValidProvider(provider string) bool {
+	_, ok := providers[provider]
+	return ok
+}
+
+// Returns a new Tunnel for the provider from the configuration.
+func New(cfg *config.Config, logger log.Logger) (Tunnel, error) {
+	provider, ok := providers[cfg.Provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %q", cfg.Provider)
+	}
+	return provider(cfg, logger), nil
+}
+
+// Returns the scheme of the public URLs, tcp when piping raw connections.
+func urlScheme(cfg *config.Config) string {
+	if cfg.Mode == "tcp" {
+		return "tcp"
+	}
+	return "http"
+}
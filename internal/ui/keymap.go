@@ -1,12 +1,30 @@
 package ui
 
-import "github.com/charmbracelet/bubbles/key"
+import (
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/viewport"
+)
 
 type keymap struct {
-	reload      key.Binding
-	quit        key.Binding
-	editCommand key.Binding
-	editing     editingKeymap
+	reload       key.Binding
+	quit         key.Binding
+	editCommand  key.Binding
+	search       key.Binding
+	nextMatch    key.Binding
+	prevMatch    key.Binding
+	clearSearch  key.Binding
+	follow       key.Binding
+	filterStream key.Binding
+	top          key.Binding
+	bottom       key.Binding
+	nextPane     key.Binding
+	prevPane     key.Binding
+	selectPane   key.Binding
+	toggleStats  key.Binding
+	toggleFaults key.Binding
+	viewport     viewport.KeyMap
+	editing      editingKeymap
+	searching    searchingKeymap
 }
 
 type editingKeymap struct {
@@ -15,6 +33,12 @@ type editingKeymap struct {
 	quit   key.Binding
 }
 
+type searchingKeymap struct {
+	confirm key.Binding
+	cancel  key.Binding
+	quit    key.Binding
+}
+
 func newKeymap() keymap {
 	return keymap{
 		reload: key.NewBinding(
@@ -29,6 +53,84 @@ func newKeymap() keymap {
 			key.WithKeys("e"),
 			key.WithHelp("e", "edit command"),
 		),
+		search: key.NewBinding(
+			key.WithKeys("/"),
+			key.WithHelp("/", "search"),
+		),
+		nextMatch: key.NewBinding(
+			key.WithKeys("n"),
+			key.WithHelp("n", "next match"),
+		),
+		prevMatch: key.NewBinding(
+			key.WithKeys("N"),
+			key.WithHelp("N", "previous match"),
+		),
+		clearSearch: key.NewBinding(
+			key.WithKeys("esc"),
+			key.WithHelp("esc", "clear search"),
+		),
+		follow: key.NewBinding(
+			key.WithKeys("f"),
+			key.WithHelp("f", "toggle follow"),
+		),
+		filterStream: key.NewBinding(
+			key.WithKeys("s"),
+			key.WithHelp("s", "filter stdout/stderr"),
+		),
+		top: key.NewBinding(
+			key.WithKeys("home", "g"),
+			key.WithHelp("home/g", "go to top"),
+		),
+		bottom: key.NewBinding(
+			key.WithKeys("end", "G"),
+			key.WithHelp("end/G", "go to bottom"),
+		),
+		nextPane: key.NewBinding(
+			key.WithKeys("tab"),
+			key.WithHelp("tab", "next pane"),
+		),
+		prevPane: key.NewBinding(
+			key.WithKeys("shift+tab"),
+			key.WithHelp("shift+tab", "previous pane"),
+		),
+		selectPane: key.NewBinding(
+			key.WithKeys("1", "2", "3", "4"),
+			key.WithHelp("1-4", "select pane"),
+		),
+		toggleStats: key.NewBinding(
+			key.WithKeys("t"),
+			key.WithHelp("t", "traffic stats"),
+		),
+		toggleFaults: key.NewBinding(
+			key.WithKeys("x"),
+			key.WithHelp("x", "toggle faults"),
+		),
+		viewport: viewport.KeyMap{
+			PageDown: key.NewBinding(
+				key.WithKeys("pgdown"),
+				key.WithHelp("pgdn", "page down"),
+			),
+			PageUp: key.NewBinding(
+				key.WithKeys("pgup"),
+				key.WithHelp("pgup", "page up"),
+			),
+			HalfPageUp: key.NewBinding(
+				key.WithKeys("ctrl+u"),
+				key.WithHelp("ctrl+u", "½ page up"),
+			),
+			HalfPageDown: key.NewBinding(
+				key.WithKeys("ctrl+d"),
+				key.WithHelp("ctrl+d", "½ page down"),
+			),
+			Up: key.NewBinding(
+				key.WithKeys("up", "k"),
+				key.WithHelp("↑/k", "up"),
+			),
+			Down: key.NewBinding(
+				key.WithKeys("down", "j"),
+				key.WithHelp("↓/j", "down"),
+			),
+		},
 		editing: editingKeymap{
 			cancel: key.NewBinding(
 				key.WithKeys("esc"),
@@ -43,5 +145,19 @@ func newKeymap() keymap {
 				key.WithHelp("ctrl+c", "quit"),
 			),
 		},
+		searching: searchingKeymap{
+			confirm: key.NewBinding(
+				key.WithKeys("enter"),
+				key.WithHelp("enter", "confirm search"),
+			),
+			cancel: key.NewBinding(
+				key.WithKeys("esc"),
+				key.WithHelp("esc", "cancel search"),
+			),
+			quit: key.NewBinding(
+				key.WithKeys("ctrl+c"),
+				key.WithHelp("ctrl+c", "quit"),
+			),
+		},
 	}
 }
@@ -0,0 +1,496 @@
+package ui
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	cmd "github.com/ivanvc/tube/internal/command"
+	"github.com/ivanvc/tube/internal/ui/styles"
+)
+
+// logLine is a line of the logs, shared by the panes showing it.
+type logLine struct {
+	term   termLine
+	text   string
+	style  lipgloss.Style
+	stream cmd.Stream
+	open   bool
+}
+
+// Writes the text over the line, it stays open if the text didn't end it
+// with a line feed.
+func (l *logLine) write(text string) {
+	l.open = !l.term.write(text)
+	l.text = l.term.plain()
+}
+
+// viewLine is a line of a logView, as rendered in its viewport. It's only
+// rendered again when it changes.
+type viewLine struct {
+	*logLine
+	rendered string
+}
+
+// The number of lines scrolled by the mouse wheel.
+const mouseWheelDelta = 3
+
+// logView holds a scrollable and searchable history of log lines.
+type logView struct {
+	keymap        viewport.KeyMap
+	width, height int
+	// The rendered visible lines, kept as they change, and the first one
+	// shown.
+	content  []string
+	offset   int
+	lines    []viewLine
+	maxLines int
+	follow   bool
+	stream   cmd.Stream
+	// While hidden, the lines are not rendered, and stale is set to render
+	// them once it's shown.
+	hidden bool
+	stale  bool
+
+	query *regexp.Regexp
+	// The indexes of the lines matching the query, among the visible ones.
+	matches []int
+	match   int
+	// The index of the line rendered as the current match, -1 if none.
+	renderedMatch int
+}
+
+func newLogView(maxLines int, keymap viewport.KeyMap) logView {
+	return logView{
+		keymap:   keymap,
+		lines:    make([]viewLine, 0, maxLines),
+		maxLines: maxLines,
+		follow:   true,
+
+		renderedMatch: -1,
+	}
+}
+
+// Sets the size of the view.
+func (l *logView) setSize(width, height int) {
+	l.width, l.height = width, height
+	l.refresh()
+}
+
+// Returns the last line, nil if there's none.
+func (l *logView) last() *logLine {
+	if len(l.lines) == 0 {
+		return nil
+	}
+	return l.lines[len(l.lines)-1].logLine
+}
+
+// Appends a line to the history, discarding the oldest ones past maxLines.
+func (l *logView) add(line *logLine) {
+	l.lines = append(l.lines, viewLine{logLine: line})
+	if n := len(l.lines) - l.maxLines; n > 0 {
+		l.discard(n)
+	}
+	if !l.hidden && l.visible(l.lines[len(l.lines)-1]) {
+		l.content = append(l.content, "")
+	}
+	l.changed(len(l.lines) - 1)
+}
+
+// Discards the oldest n lines, with their content and matches.
+func (l *logView) discard(n int) {
+	if !l.hidden {
+		var visible int
+		for _, line := range l.lines[:n] {
+			if l.visible(line) {
+				visible++
+			}
+		}
+		l.content = l.content[visible:]
+	}
+	l.lines = l.lines[n:]
+	l.discardMatches(n)
+}
+
+// Updates the line after it was written over, if it's still in the history.
+func (l *logView) rewrote(line *logLine) {
+	for i := len(l.lines) - 1; i >= 0; i-- {
+		if l.lines[i].logLine == line {
+			l.changed(i)
+			return
+		}
+	}
+}
+
+// Hides the view, its lines are rendered once it's shown again.
+func (l *logView) hide() {
+	l.hidden = true
+}
+
+// Shows the view, rendering the lines added while it was hidden.
+func (l *logView) show() {
+	l.hidden = false
+	if l.stale {
+		l.refresh()
+	}
+}
+
+// Updates the matches after the line at i changed. Only that line, and the
+// current match if it changed, are rendered again in the content.
+func (l *logView) changed(i int) {
+	visible := l.visible(l.lines[i])
+	if visible {
+		l.updateMatch(i)
+	}
+	if l.hidden {
+		l.stale = true
+		return
+	}
+	if visible {
+		l.renderContent(i)
+	}
+	l.renderMatch()
+	l.scroll()
+}
+
+// Handles scrolling messages, stops following the tail if scrolled up.
+func (l *logView) update(msg tea.Msg) tea.Cmd {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, l.keymap.PageDown):
+			l.setOffset(l.offset + l.height)
+		case key.Matches(msg, l.keymap.PageUp):
+			l.setOffset(l.offset - l.height)
+		case key.Matches(msg, l.keymap.HalfPageDown):
+			l.setOffset(l.offset + l.height/2)
+		case key.Matches(msg, l.keymap.HalfPageUp):
+			l.setOffset(l.offset - l.height/2)
+		case key.Matches(msg, l.keymap.Down):
+			l.setOffset(l.offset + 1)
+		case key.Matches(msg, l.keymap.Up):
+			l.setOffset(l.offset - 1)
+		default:
+			return nil
+		}
+	case tea.MouseMsg:
+		if msg.Action != tea.MouseActionPress {
+			return nil
+		}
+		switch msg.Button {
+		case tea.MouseButtonWheelDown:
+			l.setOffset(l.offset + mouseWheelDelta)
+		case tea.MouseButtonWheelUp:
+			l.setOffset(l.offset - mouseWheelDelta)
+		default:
+			return nil
+		}
+	default:
+		return nil
+	}
+	l.follow = l.atBottom()
+	return nil
+}
+
+// Scrolls to the top of the history.
+func (l *logView) gotoTop() {
+	l.setOffset(0)
+	l.follow = l.atBottom()
+}
+
+// Scrolls to the bottom of the history, and starts following the tail.
+func (l *logView) gotoBottom() {
+	l.setOffset(l.maxOffset())
+	l.follow = true
+}
+
+// Returns how far it's scrolled, between 0 and 1.
+func (l *logView) scrollPercent() float64 {
+	if l.maxOffset() == 0 {
+		return 1
+	}
+	return float64(l.offset) / float64(l.maxOffset())
+}
+
+// Toggles following the tail of the history.
+func (l *logView) toggleFollow() {
+	if l.follow {
+		l.follow = false
+		return
+	}
+	l.gotoBottom()
+}
+
+// Cycles between showing all of the lines, only the lines from the command's
+// stdout, and only the ones from its stderr.
+func (l *logView) cycleStream() {
+	switch l.stream {
+	case "":
+		l.stream = cmd.Stdout
+	case cmd.Stdout:
+		l.stream = cmd.Stderr
+	default:
+		l.stream = ""
+	}
+	l.findMatches()
+	l.refresh()
+}
+
+// Highlights the lines matching query (case insensitive), and jumps to the
+// first match from the current position.
+func (l *logView) search(query string) {
+	l.query = nil
+	if len(query) > 0 {
+		l.query = regexp.MustCompile("(?i)" + regexp.QuoteMeta(query))
+	}
+	l.findMatches()
+	l.match = 0
+	for i, line := range l.matches {
+		if l.contentIndex(line) >= l.offset {
+			l.match = i
+			break
+		}
+	}
+	l.refresh()
+	l.gotoMatch()
+}
+
+// Removes the current search.
+func (l *logView) clearSearch() {
+	l.search("")
+}
+
+// Returns true if there's a search active.
+func (l *logView) searching() bool {
+	return l.query != nil
+}
+
+// Jumps to the next match.
+func (l *logView) nextMatch() {
+	if len(l.matches) == 0 {
+		return
+	}
+	l.match = (l.match + 1) % len(l.matches)
+	l.renderMatch()
+	l.gotoMatch()
+}
+
+// Jumps to the previous match.
+func (l *logView) prevMatch() {
+	if len(l.matches) == 0 {
+		return
+	}
+	l.match = (l.match - 1 + len(l.matches)) % len(l.matches)
+	l.renderMatch()
+	l.gotoMatch()
+}
+
+// Returns the current match position, and the number of matches.
+func (l *logView) matchPosition() (int, int) {
+	if len(l.matches) == 0 {
+		return 0, 0
+	}
+	return l.match + 1, len(l.matches)
+}
+
+// Renders the lines shown, aligning them to the bottom if they don't fill the
+// view.
+func (l *logView) View() string {
+	shown := l.content[l.offset:min(l.offset+l.height, len(l.content))]
+	return styles.ViewportContent.
+		Width(l.width).
+		Height(l.height).
+		MaxHeight(l.height).
+		Render(strings.Join(shown, "\n"))
+}
+
+func (l *logView) gotoMatch() {
+	if len(l.matches) == 0 {
+		return
+	}
+	line := l.contentIndex(l.matches[l.match])
+	if line < l.offset || line >= l.offset+l.height {
+		l.setOffset(line - l.height/2)
+	}
+	l.follow = l.atBottom()
+}
+
+func (l *logView) findMatches() {
+	l.matches = l.matches[:0]
+	if l.query == nil {
+		return
+	}
+	for i, line := range l.lines {
+		if l.visible(line) && l.query.MatchString(line.text) {
+			l.matches = append(l.matches, i)
+		}
+	}
+	if l.match >= len(l.matches) {
+		l.match = max(0, len(l.matches)-1)
+	}
+}
+
+// Updates whether the line at i matches the query, keeping the current
+// match.
+func (l *logView) updateMatch(i int) {
+	if l.query == nil {
+		return
+	}
+	pos := sort.SearchInts(l.matches, i)
+	matched := pos < len(l.matches) && l.matches[pos] == i
+	switch matches := l.query.MatchString(l.lines[i].text); {
+	case matches && !matched:
+		l.matches = append(l.matches, 0)
+		copy(l.matches[pos+1:], l.matches[pos:])
+		l.matches[pos] = i
+		if pos <= l.match && len(l.matches) > 1 {
+			l.match++
+		}
+	case !matches && matched:
+		l.matches = append(l.matches[:pos], l.matches[pos+1:]...)
+		if pos < l.match {
+			l.match--
+		}
+		if l.match >= len(l.matches) {
+			l.match = max(0, len(l.matches)-1)
+		}
+	}
+}
+
+// Removes the matches of the first n lines, which were discarded, and moves
+// the rest.
+func (l *logView) discardMatches(n int) {
+	var discarded int
+	for discarded < len(l.matches) && l.matches[discarded] < n {
+		discarded++
+	}
+	matches := l.matches[:0]
+	for _, i := range l.matches[discarded:] {
+		matches = append(matches, i-n)
+	}
+	l.matches = matches
+	l.match = max(0, l.match-discarded)
+	if l.renderedMatch -= n; l.renderedMatch < 0 {
+		l.renderedMatch = -1
+	}
+}
+
+// Renders every visible line, and builds the content again. Used when the
+// width, the query, or the visible stream change, or once it's shown.
+func (l *logView) refresh() {
+	if l.hidden {
+		l.stale = true
+		return
+	}
+	l.stale = false
+	l.content = l.content[:0]
+	for i := range l.lines {
+		if l.visible(l.lines[i]) {
+			l.render(i)
+			l.content = append(l.content, l.lines[i].rendered)
+		}
+	}
+	l.renderedMatch = l.currentMatch()
+	l.scroll()
+}
+
+// Renders the previous and the new current match, if it changed.
+func (l *logView) renderMatch() {
+	current := l.currentMatch()
+	if current == l.renderedMatch {
+		return
+	}
+	if l.renderedMatch >= 0 {
+		l.renderContent(l.renderedMatch)
+	}
+	if current >= 0 {
+		l.renderContent(current)
+	}
+	l.renderedMatch = current
+}
+
+// Keeps the offset within the content after it changed, or moves it to the
+// bottom if following the tail.
+func (l *logView) scroll() {
+	if l.follow {
+		l.offset = l.maxOffset()
+		return
+	}
+	l.setOffset(l.offset)
+}
+
+func (l *logView) setOffset(offset int) {
+	l.offset = max(0, min(offset, l.maxOffset()))
+}
+
+func (l *logView) maxOffset() int {
+	return max(0, len(l.content)-l.height)
+}
+
+func (l *logView) atBottom() bool {
+	return l.offset >= l.maxOffset()
+}
+
+// Returns the index of the current match, -1 if there's none.
+func (l *logView) currentMatch() int {
+	if len(l.matches) == 0 {
+		return -1
+	}
+	return l.matches[l.match]
+}
+
+// Returns true if the line is from the visible stream.
+func (l *logView) visible(line viewLine) bool {
+	return len(l.stream) == 0 || line.stream == l.stream
+}
+
+// Returns the position in the content of the visible line at i. It counts
+// from the tail, as that's where the lines are written.
+func (l *logView) contentIndex(i int) int {
+	n := len(l.content) - len(l.lines[i+1:]) - 1
+	if len(l.stream) > 0 {
+		n = len(l.content) - 1
+		for _, line := range l.lines[i+1:] {
+			if l.visible(line) {
+				n--
+			}
+		}
+	}
+	return n
+}
+
+func (l *logView) render(i int) {
+	l.lines[i].rendered = l.renderLine(l.lines[i].logLine, i == l.currentMatch())
+}
+
+// Renders the visible line at i, and replaces it in the content.
+func (l *logView) renderContent(i int) {
+	l.render(i)
+	l.content[l.contentIndex(i)] = l.lines[i].rendered
+}
+
+func (l *logView) renderLine(line *logLine, current bool) string {
+	style := line.style.Copy().Inline(true)
+	highlight := styles.SearchMatch.Copy().Inline(true)
+	if current {
+		highlight = styles.CurrentSearchMatch.Copy().Inline(true)
+	}
+
+	var highlights [][2]int
+	if l.query != nil {
+		for _, loc := range l.query.FindAllStringIndex(line.text, -1) {
+			start := utf8.RuneCountInString(line.text[:loc[0]])
+			highlights = append(highlights, [2]int{
+				start,
+				start + utf8.RuneCountInString(line.text[loc[0]:loc[1]]),
+			})
+		}
+	}
+	return line.term.render(l.width, style, highlight, highlights)
+}
@@ -0,0 +1,135 @@
+package ui
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+
+	cmd "github.com/ivanvc/tube/internal/command"
+)
+
+// Returns the content of the view, as built from scratch.
+func rebuiltContent(l *logView) []string {
+	var content []string
+	for i, line := range l.lines {
+		if l.visible(line) {
+			content = append(content, l.renderLine(line.logLine, i == l.currentMatch()))
+		}
+	}
+	return content
+}
+
+func TestLogViewContent(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(p *panes)
+	}{
+		{"append", func(p *panes) {
+			for i := 0; i < 20; i++ {
+				p.appendCommandOutput(fmt.Sprintf("line %d\n", i))
+			}
+		}},
+		{"rewrite", func(p *panes) {
+			p.appendCommandOutput("first\n")
+			for i := 0; i <= 100; i += 10 {
+				p.appendCommandOutput(fmt.Sprintf("\r%d%%", i))
+			}
+			p.appendCommandOutput("\n")
+			p.appendCommandOutput("last\n")
+		}},
+		{"discard", func(p *panes) {
+			for i := 0; i < 30; i++ {
+				p.appendCommandOutput(fmt.Sprintf("line %d\n", i))
+				p.appendCommandErrOutput(fmt.Sprintf("error %d\n", i))
+			}
+		}},
+		{"stream", func(p *panes) {
+			p.current().cycleStream()
+			for i := 0; i < 30; i++ {
+				p.appendCommandOutput(fmt.Sprintf("line %d\n", i))
+				p.appendCommandErrOutput(fmt.Sprintf("error %d", i))
+				p.appendCommandErrOutput("\r\n")
+			}
+		}},
+		{"search", func(p *panes) {
+			for i := 0; i < 10; i++ {
+				p.appendCommandOutput(fmt.Sprintf("line %d\n", i))
+			}
+			p.current().search("line 1")
+			p.current().nextMatch()
+			for i := 10; i < 30; i++ {
+				p.appendCommandOutput(fmt.Sprintf("line %d\n", i))
+			}
+			p.current().prevMatch()
+		}},
+		{"hidden", func(p *panes) {
+			p.next()
+			for i := 0; i < 30; i++ {
+				p.appendCommandOutput(fmt.Sprintf("line %d\n", i))
+				p.appendRequest(fmt.Sprintf("GET /%d", i))
+			}
+			p.prev()
+			p.appendCommandOutput("last\n")
+		}},
+		{"resize", func(p *panes) {
+			for i := 0; i < 10; i++ {
+				p.appendCommandOutput(fmt.Sprintf("a longer line %d\n", i))
+			}
+			p.setSize(5, 3)
+			p.appendCommandOutput("another longer line\n")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPanes(25, newKeymap().viewport)
+			p.setSize(40, 10)
+			tt.run(&p)
+			for i := range p.list {
+				l := &p.list[i].logs
+				if l.hidden {
+					continue
+				}
+				want := rebuiltContent(l)
+				if len(l.content) != len(want) {
+					t.Fatalf("pane %d has %d lines, want %d", i, len(l.content), len(want))
+				}
+				for j := range want {
+					if l.content[j] != want[j] {
+						t.Errorf("pane %d line %d = %q, want %q", i, j, l.content[j], want[j])
+					}
+				}
+				if l.follow && l.offset != l.maxOffset() {
+					t.Errorf("pane %d is following at offset %d, want %d", i, l.offset, l.maxOffset())
+				}
+			}
+		})
+	}
+}
+
+func TestLogViewScroll(t *testing.T) {
+	l := newLogView(100, newKeymap().viewport)
+	l.setSize(20, 5)
+	for i := 0; i < 20; i++ {
+		line := &logLine{style: lipgloss.NewStyle(), stream: cmd.Stdout}
+		line.write(fmt.Sprintf("line %d\n", i))
+		l.add(line)
+	}
+	if l.offset != 15 || !l.follow {
+		t.Fatalf("offset %d (follow %v), want 15 following", l.offset, l.follow)
+	}
+	l.gotoTop()
+	line := &logLine{style: lipgloss.NewStyle(), stream: cmd.Stdout}
+	line.write("new\n")
+	l.add(line)
+	if l.offset != 0 || l.follow {
+		t.Fatalf("offset %d (follow %v), want 0 paused", l.offset, l.follow)
+	}
+	if got := l.scrollPercent(); got != 0 {
+		t.Errorf("scrolled %v, want 0", got)
+	}
+	l.gotoBottom()
+	if l.offset != 16 || !l.follow {
+		t.Errorf("offset %d (follow %v), want 16 following", l.offset, l.follow)
+	}
+}
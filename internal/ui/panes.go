@@ -0,0 +1,140 @@
+package ui
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	"github.com/charmbracelet/lipgloss"
+
+	cmd "github.com/ivanvc/tube/internal/command"
+	"github.com/ivanvc/tube/internal/ui/styles"
+)
+
+var (
+	errorLevel = regexp.MustCompile(`\bERRO\b|\blvl=error\b|"lvl":"error"`)
+	warnLevel  = regexp.MustCompile(`\bWARN\b|\blvl=warn\b|"lvl":"warn"`)
+)
+
+type paneKind int
+
+const (
+	allPane paneKind = iota
+	outputPane
+	requestsPane
+	eventsPane
+)
+
+type pane struct {
+	title string
+	logs  logView
+}
+
+// panes holds the log panes, each one with its own scrollback.
+type panes struct {
+	list   []pane
+	active paneKind
+}
+
+func newPanes(maxLines int, keymap viewport.KeyMap) panes {
+	p := panes{
+		list: []pane{
+			allPane:      {title: "All", logs: newLogView(maxLines, keymap)},
+			outputPane:   {title: "Output", logs: newLogView(maxLines, keymap)},
+			requestsPane: {title: "Requests", logs: newLogView(maxLines, keymap)},
+			eventsPane:   {title: "Events", logs: newLogView(maxLines, keymap)},
+		},
+	}
+	for i := range p.list {
+		if paneKind(i) != p.active {
+			p.list[i].logs.hide()
+		}
+	}
+	return p
+}
+
+// Returns the logs of the active pane.
+func (p *panes) current() *logView {
+	return &p.list[p.active].logs
+}
+
+// Appends the line to the given pane, and to the pane with all of the lines,
+// both share it. The stream is empty for lines that are not from the command
+// output. If the pane's last line from the same stream wasn't ended by a line
+// feed (i.e., a progress bar rewriting it with a carriage return), the line
+// is written over it.
+func (p *panes) append(kind paneKind, stream cmd.Stream, style lipgloss.Style, text string) {
+	logs := &p.list[kind].logs
+	if line := logs.last(); line != nil && line.open && line.stream == stream {
+		line.write(text)
+		logs.rewrote(line)
+		p.list[allPane].logs.rewrote(line)
+		return
+	}
+	line := &logLine{style: style, stream: stream}
+	line.write(text)
+	p.list[allPane].logs.add(line)
+	logs.add(line)
+}
+
+// Appends a line from the command's stdout.
+func (p *panes) appendCommandOutput(line string) {
+	p.append(outputPane, cmd.Stdout, styles.CommandLogLine, line)
+}
+
+// Appends a line from the command's stderr.
+func (p *panes) appendCommandErrOutput(line string) {
+	p.append(outputPane, cmd.Stderr, styles.CommandErrLogLine, line)
+}
+
+// Appends a line from the requests log, highlighting the failed and slow
+// requests.
+func (p *panes) appendRequest(line string) {
+	style := styles.RequestLogLine
+	if errorLevel.MatchString(line) {
+		style = styles.FailedRequestLogLine
+	} else if warnLevel.MatchString(line) {
+		style = styles.SlowRequestLogLine
+	}
+	p.append(requestsPane, "", style, line)
+}
+
+// Sets the size of the viewport of every pane.
+func (p *panes) setSize(width, height int) {
+	for i := range p.list {
+		p.list[i].logs.setSize(width, height)
+	}
+}
+
+// Activates the next pane.
+func (p *panes) next() {
+	p.activate(int(p.active+1) % len(p.list))
+}
+
+// Activates the previous pane.
+func (p *panes) prev() {
+	p.activate((int(p.active) - 1 + len(p.list)) % len(p.list))
+}
+
+// Activates the pane at the given position, if it exists. Only the active
+// pane renders its lines.
+func (p *panes) activate(i int) {
+	if i >= 0 && i < len(p.list) {
+		p.current().hide()
+		p.active = paneKind(i)
+		p.current().show()
+	}
+}
+
+// Renders the tabs with the title of the panes.
+func (p *panes) tabsView() string {
+	tabs := make([]string, len(p.list))
+	for i, pane := range p.list {
+		style := styles.Tab
+		if paneKind(i) == p.active {
+			style = styles.ActiveTab
+		}
+		tabs[i] = style.Render(pane.title)
+	}
+	return strings.Join(tabs, " ")
+}
@@ -0,0 +1,137 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/ivanvc/tube/internal/server"
+	"github.com/ivanvc/tube/internal/ui/styles"
+)
+
+// The width of the statistics panel content.
+const statsWidth = 30
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+type statsTickMsg time.Time
+
+func tickStats() tea.Cmd {
+	return tea.Tick(time.Second, func(t time.Time) tea.Msg {
+		return statsTickMsg(t)
+	})
+}
+
+// Renders the traffic statistics panel.
+func statsView(s server.StatsSnapshot, height int) string {
+	row := func(label, value string) string {
+		return lipgloss.JoinHorizontal(
+			lipgloss.Top,
+			styles.StatsLabel.Width(10).Render(label),
+			value,
+		)
+	}
+	lines := []string{
+		styles.StatsTitle.Render("Traffic"),
+		row("Requests", fmt.Sprintf("%d (%.1f/s)", s.Requests, s.Rate)),
+		row("Active", fmt.Sprintf("%d requests", s.Active)),
+		row("Streams", fmt.Sprintf("%d ws, %d sse", s.WebSockets, s.EventStreams)),
+		row("Busy", busyView(s)),
+		row("Keepalive", fmt.Sprintf("%d open, %d idle", s.Connections, s.Connections-s.Busy)),
+		"",
+		styles.StatsTitle.Render("Status"),
+		row("2xx", styles.Status2xx.Render(fmt.Sprint(s.Statuses[1]))),
+		row("3xx", styles.Status3xx.Render(fmt.Sprint(s.Statuses[2]))),
+		row("4xx", styles.Status4xx.Render(fmt.Sprint(s.Statuses[3]))),
+		row("5xx", styles.Status5xx.Render(fmt.Sprint(s.Statuses[4]))),
+		row("Limited", fmt.Sprintf("%d rate, %d body", s.RateLimited, s.TooLarge)),
+		row("Faults", faultsView(s)),
+		"",
+		styles.StatsTitle.Render("Latency"),
+		row("p50", formatDuration(s.P50)),
+		row("p95", formatDuration(s.P95)),
+		row("p99", formatDuration(s.P99)),
+		"",
+		styles.StatsTitle.Render("Bytes"),
+		row("In", formatBytes(s.BytesIn)),
+		row("Out", formatBytes(s.BytesOut)),
+		"",
+		styles.StatsTitle.Render("Requests/s"),
+		styles.Sparkline.Render(sparkline(s.History, statsWidth)),
+	}
+	return lipgloss.NewStyle().
+		Width(statsWidth).
+		Height(height).
+		MaxHeight(height).
+		Render(strings.Join(lines, "\n"))
+}
+
+// Renders the requests with injected faults, highlighted while the fault
+// injection is enabled.
+func faultsView(s server.StatsSnapshot) string {
+	if !s.FaultsConfigured {
+		return "-"
+	}
+	if s.FaultsEnabled {
+		return styles.FaultsEnabled.Render(fmt.Sprintf("%d (on)", s.Faults))
+	}
+	return fmt.Sprintf("%d (off)", s.Faults)
+}
+
+// Renders the busy connections, out of the configured maximum of tunnel
+// connections, highlighted once all of them are busy.
+func busyView(s server.StatsSnapshot) string {
+	if s.MaxConnections == 0 {
+		return fmt.Sprint(s.Busy)
+	}
+	v := fmt.Sprintf("%d (max %d)", s.Busy, s.MaxConnections)
+	if s.Busy >= s.MaxConnections {
+		return styles.PoolSaturated.Render(v)
+	}
+	return v
+}
+
+// Renders the last width values as a sparkline.
+func sparkline(values []int, width int) string {
+	values = values[max(0, len(values)-width):]
+	var top int
+	for _, v := range values {
+		top = max(top, v)
+	}
+	var b strings.Builder
+	for _, v := range values {
+		if top == 0 {
+			b.WriteRune(sparks[0])
+			continue
+		}
+		b.WriteRune(sparks[v*(len(sparks)-1)/top])
+	}
+	return b.String()
+}
+
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		return d.Round(10 * time.Millisecond).String()
+	case d >= time.Millisecond:
+		return d.Round(100 * time.Microsecond).String()
+	default:
+		return d.Round(time.Microsecond).String()
+	}
+}
+
+func formatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -8,9 +8,28 @@ var (
 	Footer     = lipgloss.NewStyle().Padding(0, 1).Foreground(lipgloss.Color("4"))
 	Viewport   = lipgloss.NewStyle().BorderStyle(lipgloss.NormalBorder()).
 			BorderForeground(lipgloss.Color("4")).Padding(0, 1)
-	ViewportContent = lipgloss.NewStyle().AlignVertical(lipgloss.Bottom).Align(lipgloss.Left)
-	Help            = lipgloss.NewStyle()
-	Link            = lipgloss.NewStyle().Underline(true).Foreground(lipgloss.Color("5"))
-	LogLine         = lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
-	CommandLogLine  = lipgloss.NewStyle()
+	ViewportContent      = lipgloss.NewStyle().AlignVertical(lipgloss.Bottom).Align(lipgloss.Left)
+	Help                 = lipgloss.NewStyle()
+	Link                 = lipgloss.NewStyle().Underline(true).Foreground(lipgloss.Color("5"))
+	LogLine              = lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
+	CommandLogLine       = lipgloss.NewStyle()
+	CommandErrLogLine    = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	RequestLogLine       = lipgloss.NewStyle().Foreground(lipgloss.Color("6"))
+	SlowRequestLogLine   = lipgloss.NewStyle().Foreground(lipgloss.Color("3")).Bold(true)
+	FailedRequestLogLine = lipgloss.NewStyle().Foreground(lipgloss.Color("1")).Bold(true)
+	SearchMatch          = lipgloss.NewStyle().Background(lipgloss.Color("3")).Foreground(lipgloss.Color("0"))
+	CurrentSearchMatch   = lipgloss.NewStyle().Background(lipgloss.Color("5")).Foreground(lipgloss.Color("0"))
+	Status               = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	StatsTitle           = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("5"))
+	StatsLabel           = lipgloss.NewStyle().Foreground(lipgloss.Color("4"))
+	Status2xx            = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	Status3xx            = lipgloss.NewStyle().Foreground(lipgloss.Color("6"))
+	Status4xx            = lipgloss.NewStyle().Foreground(lipgloss.Color("3"))
+	Status5xx            = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+	Sparkline            = lipgloss.NewStyle().Foreground(lipgloss.Color("141"))
+	PoolSaturated        = lipgloss.NewStyle().Foreground(lipgloss.Color("3")).Bold(true)
+	FaultsEnabled        = lipgloss.NewStyle().Foreground(lipgloss.Color("1")).Bold(true)
+	Tabs                 = lipgloss.NewStyle().Padding(0, 1)
+	Tab                  = lipgloss.NewStyle().Padding(0, 1).Foreground(lipgloss.Color("4"))
+	ActiveTab            = Tab.Copy().Reverse(true)
 )
@@ -0,0 +1,310 @@
+package ui
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+)
+
+const sgrReset = "\x1b[0m"
+
+type cell struct {
+	r   rune
+	sgr string
+}
+
+// termLine holds a line of output as a terminal would display it. It
+// interprets carriage returns, backspaces, tabs and erase line sequences, and
+// keeps the SGR sequences (colors and text attributes) for every cell.
+type termLine struct {
+	cells []cell
+	col   int
+	style sgrStyle
+	// The sequence rendering style, shared by the cells written with it.
+	sgr string
+}
+
+// Writes the text to the line, returns true if the text ended the line with
+// a line feed.
+func (t *termLine) write(s string) bool {
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch r {
+		case '\n':
+			return true
+		case '\r':
+			t.col = 0
+		case '\b':
+			t.col = max(0, t.col-1)
+		case '\t':
+			t.put(' ')
+			for t.col%8 != 0 {
+				t.put(' ')
+			}
+		case '\x1b':
+			size = t.escape(s[i:])
+		default:
+			if r >= ' ' && r != utf8.RuneError {
+				t.put(r)
+			}
+		}
+		i += size
+	}
+	return false
+}
+
+// Returns the text of the line, without any escape sequences.
+func (t *termLine) plain() string {
+	var b strings.Builder
+	for _, c := range t.cells {
+		b.WriteRune(c.r)
+	}
+	return b.String()
+}
+
+// Renders the line up to width columns. Cells without SGR sequences are
+// rendered with style, and the cells within the highlights ranges (in runes)
+// with highlight.
+func (t *termLine) render(width int, style, highlight lipgloss.Style, highlights [][2]int) string {
+	var (
+		b      strings.Builder
+		group  strings.Builder
+		sgr    string
+		marked bool
+		w      int
+	)
+	flush := func() {
+		if group.Len() == 0 {
+			return
+		}
+		switch {
+		case marked:
+			b.WriteString(highlight.Render(group.String()))
+		case len(sgr) > 0:
+			b.WriteString(sgr + group.String() + sgrReset)
+		default:
+			b.WriteString(style.Render(group.String()))
+		}
+		group.Reset()
+	}
+
+	for i, c := range t.cells {
+		if w += runewidth.RuneWidth(c.r); w > width {
+			break
+		}
+		m := false
+		for _, h := range highlights {
+			if i >= h[0] && i < h[1] {
+				m = true
+				break
+			}
+		}
+		if c.sgr != sgr || m != marked {
+			flush()
+			sgr, marked = c.sgr, m
+		}
+		group.WriteRune(c.r)
+	}
+	flush()
+	return b.String()
+}
+
+func (t *termLine) put(r rune) {
+	for len(t.cells) < t.col {
+		t.cells = append(t.cells, cell{r: ' '})
+	}
+	c := cell{r: r, sgr: t.sgr}
+	if t.col < len(t.cells) {
+		t.cells[t.col] = c
+	} else {
+		t.cells = append(t.cells, c)
+	}
+	t.col++
+}
+
+// Handles the escape sequence at the beginning of s, returns its length.
+func (t *termLine) escape(s string) int {
+	if len(s) < 2 {
+		return len(s)
+	}
+	switch s[1] {
+	case '[':
+		// Control Sequence Introducer: parameters, intermediate bytes, and a
+		// final byte in the 0x40-0x7e range.
+		end := 2
+		for end < len(s) && (s[end] < 0x40 || s[end] > 0x7e) {
+			end++
+		}
+		if end == len(s) {
+			return len(s)
+		}
+		t.csi(s[2:end], s[end])
+		return end + 1
+	case ']':
+		// Operating System Command (i.e., hyperlinks, window title), ends with
+		// BEL or ST. They're discarded.
+		for end := 2; end < len(s); end++ {
+			if s[end] == '\a' {
+				return end + 1
+			}
+			if s[end] == '\x1b' && end+1 < len(s) && s[end+1] == '\\' {
+				return end + 2
+			}
+		}
+		return len(s)
+	default:
+		return 2
+	}
+}
+
+func (t *termLine) csi(params string, final byte) {
+	n, err := strconv.Atoi(params)
+	if err != nil {
+		n = 0
+	}
+	switch final {
+	case 'm':
+		t.setSGR(params)
+	case 'K':
+		switch n {
+		case 0:
+			if t.col < len(t.cells) {
+				t.cells = t.cells[:t.col]
+			}
+		case 1:
+			for i := 0; i <= t.col && i < len(t.cells); i++ {
+				t.cells[i] = cell{r: ' '}
+			}
+		case 2:
+			t.cells = t.cells[:0]
+		}
+	case 'G':
+		t.col = max(0, n-1)
+	case 'C':
+		t.col += max(1, n)
+	case 'D':
+		t.col = max(0, t.col-max(1, n))
+	}
+}
+
+// Applies the SGR parameters to the current style. The style is kept as its
+// attributes and colors, so sequences that override each other don't pile up.
+func (t *termLine) setSGR(params string) {
+	t.style.apply(params)
+	t.sgr = t.style.sequence()
+}
+
+// The text attributes, in the order they're rendered, with the parameters
+// that set and clear them.
+var sgrAttrs = []struct{ set, clear string }{
+	{"1", "22"},  // Bold.
+	{"2", "22"},  // Faint.
+	{"3", "23"},  // Italic.
+	{"4", "24"},  // Underline.
+	{"5", "25"},  // Blink.
+	{"7", "27"},  // Inverse.
+	{"8", "28"},  // Hidden.
+	{"9", "29"},  // Crossed out.
+	{"53", "55"}, // Overlined.
+}
+
+// sgrStyle is the style set by the SGR sequences: the text attributes (a bit
+// per sgrAttrs entry), and the foreground, background and underline colors
+// as their parameters.
+type sgrStyle struct {
+	attrs      uint16
+	fg, bg, ul string
+}
+
+func (s *sgrStyle) apply(params string) {
+	parts := strings.Split(params, ";")
+	for i := 0; i < len(parts); i++ {
+		p := parts[i]
+		// Sub-parameters, i.e., 38:5:208 or 4:3 (curly underline).
+		code, _, _ := strings.Cut(p, ":")
+		switch code {
+		case "", "0":
+			*s = sgrStyle{}
+			continue
+		case "6":
+			code = "5"
+		case "21":
+			code = "4"
+		case "4":
+			if p == "4:0" {
+				code = "24"
+			}
+		case "39":
+			s.fg = ""
+		case "49":
+			s.bg = ""
+		case "59":
+			s.ul = ""
+		case "38", "48", "58":
+			color := p
+			if code == p {
+				// The extended color takes the next parameters, either the
+				// 256 colors index, or the RGB components.
+				n := 0
+				if i+1 < len(parts) && parts[i+1] == "5" {
+					n = 2
+				} else if i+1 < len(parts) && parts[i+1] == "2" {
+					n = 4
+				}
+				if n == 0 || i+n >= len(parts) {
+					return
+				}
+				color = strings.Join(parts[i:i+n+1], ";")
+				i += n
+			}
+			switch code {
+			case "38":
+				s.fg = color
+			case "48":
+				s.bg = color
+			default:
+				s.ul = color
+			}
+			continue
+		}
+		if n, err := strconv.Atoi(code); err == nil {
+			switch {
+			case n >= 30 && n <= 37, n >= 90 && n <= 97:
+				s.fg = code
+			case n >= 40 && n <= 47, n >= 100 && n <= 107:
+				s.bg = code
+			}
+		}
+		for j, a := range sgrAttrs {
+			switch code {
+			case a.set:
+				s.attrs |= 1 << j
+			case a.clear:
+				s.attrs &^= 1 << j
+			}
+		}
+	}
+}
+
+// Returns the SGR sequence rendering the style, or an empty string if it's
+// the default one.
+func (s *sgrStyle) sequence() string {
+	var parts []string
+	for j, a := range sgrAttrs {
+		if s.attrs&(1<<j) != 0 {
+			parts = append(parts, a.set)
+		}
+	}
+	for _, color := range []string{s.fg, s.bg, s.ul} {
+		if len(color) > 0 {
+			parts = append(parts, color)
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "\x1b[" + strings.Join(parts, ";") + "m"
+}
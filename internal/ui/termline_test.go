@@ -0,0 +1,86 @@
+package ui
+
+import "testing"
+
+func TestTermLineWrite(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []string
+		want  string
+		done  bool
+	}{
+		{"plain", []string{"hello"}, "hello", false},
+		{"line feed", []string{"hello\n"}, "hello", true},
+		{"carriage return", []string{"hello\rj"}, "jello", false},
+		{"progress", []string{"10%", "\r50%", "\r100%\n"}, "100%", true},
+		{"backspace", []string{"ab\bc"}, "ac", false},
+		{"tab", []string{"a\tb"}, "a       b", false},
+		{"erase to end", []string{"hello\r\x1b[Kbye"}, "bye", false},
+		{"erase to start", []string{"hello\x1b[3D\x1b[1K"}, "   lo", false},
+		{"erase line", []string{"hello\x1b[2Kbye"}, "     bye", false},
+		{"column", []string{"hello\x1b[2GA"}, "hAllo", false},
+		{"forward", []string{"a\x1b[2Cb"}, "a  b", false},
+		{"colors", []string{"\x1b[31mred\x1b[0m"}, "red", false},
+		{"hyperlink", []string{"\x1b]8;;https://example.com\x07link\x1b]8;;\x1b\\"}, "link", false},
+		{"control", []string{"a\x07b"}, "ab", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				l    termLine
+				done bool
+			)
+			for _, s := range tt.input {
+				done = l.write(s)
+			}
+			if got := l.plain(); got != tt.want || done != tt.done {
+				t.Errorf("got %q (done %v), want %q (done %v)", got, done, tt.want, tt.done)
+			}
+		})
+	}
+}
+
+func TestTermLineSGR(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"none", "a", ""},
+		{"color", "\x1b[31ma", "\x1b[31m"},
+		{"reset", "\x1b[31m\x1b[0ma", ""},
+		{"empty reset", "\x1b[31m\x1b[ma", ""},
+		{"reset first", "\x1b[0;1;32ma", "\x1b[1;32m"},
+		{"reset last", "\x1b[1;32;0ma", ""},
+		{"combined", "\x1b[1m\x1b[4m\x1b[32ma", "\x1b[1;4;32m"},
+		{"override color", "\x1b[31m\x1b[32m\x1b[33ma", "\x1b[33m"},
+		{"default color", "\x1b[31;44m\x1b[39ma", "\x1b[44m"},
+		{"clear attribute", "\x1b[1;3m\x1b[22ma", "\x1b[3m"},
+		{"256 colors", "\x1b[38;5;0ma", "\x1b[38;5;0m"},
+		{"rgb", "\x1b[48;2;0;0;0;1ma", "\x1b[1;48;2;0;0;0m"},
+		{"sub-parameters", "\x1b[38:5:208;4:3ma", "\x1b[4;38:5:208m"},
+		{"underline off", "\x1b[4m\x1b[4:0ma", ""},
+		{"incomplete color", "\x1b[1;38;5ma", "\x1b[1m"},
+		{"unknown", "\x1b[1;73ma", "\x1b[1m"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var l termLine
+			l.write(tt.input)
+			if got := l.cells[len(l.cells)-1].sgr; got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTermLineSGRBounded(t *testing.T) {
+	var l termLine
+	for i := 0; i < 1000; i++ {
+		l.write("\x1b[1m\x1b[31m\x1b[32m\x1b[22m")
+	}
+	l.write("a")
+	if want := "\x1b[32m"; l.sgr != want {
+		t.Errorf("got %q, want %q", l.sgr, want)
+	}
+}
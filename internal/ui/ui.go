@@ -13,6 +13,7 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 
+	"github.com/ivanvc/tube/internal/admin"
 	cmd "github.com/ivanvc/tube/internal/command"
 	"github.com/ivanvc/tube/internal/config"
 	"github.com/ivanvc/tube/internal/log"
@@ -21,10 +22,13 @@ import (
 )
 
 type newCommandLogLineMsg string
+type newCommandErrLogLineMsg string
 type newLogLineMsg string
+type newRequestLogLineMsg string
 type listenerReadyMsg string
 type serverTerminatedMsg struct{}
 type watcherGotChangesMsg struct{}
+type adminActionMsg admin.Action
 
 type ui struct {
 	cfg    *config.Config
@@ -37,49 +41,84 @@ type ui struct {
 	keymap         keymap
 	help           help.Model
 	textInput      textinput.Model
+	searchInput    textinput.Model
 	ready          bool
 	addr           string
 
-	logLinesChan    chan string
-	commandLogsChan chan string
-	changesChan     chan watcherGotChangesMsg
-	commandReader   *bufio.Reader
-	logger          log.Logger
-	viewportContent []string
-	editingCommand  bool
+	logLinesChan       chan string
+	requestLogsChan    chan string
+	commandLogsChan    chan string
+	commandErrLogsChan chan string
+	changesChan        chan watcherGotChangesMsg
+	commandReader      *bufio.Reader
+	commandErrReader   *bufio.Reader
+	logger             log.Logger
+	requestLogger      log.Logger
+	panes              panes
+	editingCommand     bool
+	searchingLogs      bool
+	showStats          bool
+	stats              server.StatsSnapshot
 
 	manager *cmd.Manager
 	watcher *cmd.Watcher
+	api     *admin.Server
 }
 
-const maxLines = 1000
-
-// Returns a new UI
-func New(cfg *config.Config) *ui {
+// Returns a new UI, the logs are written to logFile as well, if it's not nil.
+// It starts listening on the admin address, before the UI runs.
+func New(cfg *config.Config, logFile *log.File) (*ui, error) {
 	s := spinner.New()
 	s.Spinner = spinner.MiniDot
 	s.Style = styles.FooterText
 	ti := textinput.New()
 	ti.Placeholder = "Command to execute"
-	logger := log.NewBuffered()
+	si := textinput.New()
+	si.Prompt = "/"
+	si.Placeholder = "Search logs"
+	logger := log.NewBuffered(cfg)
+	requestLogger := log.NewBuffered(cfg)
 	r, w := io.Pipe()
+	er, ew := io.Pipe()
+	recentLogs := log.NewRing(cfg.MaxLines)
+	sinks := log.MultiSink{recentLogs}
+	if logFile != nil {
+		sinks = append(sinks, logFile)
+	}
+	logger.Tee(sinks.Writer("tube"))
+	requestLogger.Tee(sinks.Writer("requests"))
+	stdout := io.MultiWriter(w, sinks.Writer(string(cmd.Stdout)))
+	stderr := io.MultiWriter(ew, sinks.Writer(string(cmd.Stderr)))
+	km := newKeymap()
+	server := server.New(cfg, logger, requestLogger)
+	manager := cmd.NewManager(cfg, logger, stdout, stderr)
+	api := admin.New(cfg, logger, server, manager, recentLogs)
+	if err := api.Listen(); err != nil {
+		return nil, err
+	}
 
 	return &ui{
-		cfg:             cfg,
-		server:          server.New(cfg, logger),
-		keymap:          newKeymap(),
-		spinner:         s,
-		help:            help.New(),
-		logLinesChan:    make(chan string),
-		commandLogsChan: make(chan string),
-		changesChan:     make(chan watcherGotChangesMsg),
-		logger:          logger,
-		viewportContent: make([]string, 0, maxLines),
-		manager:         cmd.NewManager(logger, w),
-		commandReader:   bufio.NewReader(r),
-		textInput:       ti,
-		watcher:         cmd.NewWatcher(cfg, logger),
-	}
+		cfg:                cfg,
+		server:             server,
+		keymap:             km,
+		spinner:            s,
+		help:               help.New(),
+		logLinesChan:       make(chan string),
+		requestLogsChan:    make(chan string),
+		commandLogsChan:    make(chan string),
+		commandErrLogsChan: make(chan string),
+		changesChan:        make(chan watcherGotChangesMsg),
+		logger:             logger,
+		requestLogger:      requestLogger,
+		panes:              newPanes(max(cfg.MaxLines, 1), km.viewport),
+		manager:            manager,
+		commandReader:      bufio.NewReader(r),
+		commandErrReader:   bufio.NewReader(er),
+		textInput:          ti,
+		searchInput:        si,
+		watcher:            cmd.NewWatcher(cfg, logger),
+		api:                api,
+	}, nil
 }
 
 // Init implements tea.Model.
@@ -89,10 +128,17 @@ func (ui ui) Init() tea.Cmd {
 		textinput.Blink,
 		listenForLogs(ui.logLinesChan, ui.logger.Reader()),
 		waitForLogLines(ui.logLinesChan),
+		listenForLogs(ui.requestLogsChan, ui.requestLogger.Reader()),
+		waitForRequestLogLines(ui.requestLogsChan),
 		listenForLogs(ui.commandLogsChan, ui.commandReader),
 		waitForCommandLogs(ui.commandLogsChan),
+		listenForLogs(ui.commandErrLogsChan, ui.commandErrReader),
+		waitForCommandErrLogs(ui.commandErrLogsChan),
 		startListener(ui.server, ui.logger),
 		listenForChanges(ui.watcher),
+		serveAdmin(ui.api, ui.logger),
+		listenForActions(ui.api),
+		tickStats(),
 	)
 }
 
@@ -119,8 +165,30 @@ func (ui ui) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			case key.Matches(msg, ui.keymap.editing.quit):
 				return ui, quitSeq(ui)
 			}
+		} else if ui.searchingLogs {
+			switch {
+			case key.Matches(msg, ui.keymap.searching.confirm):
+				ui.searchingLogs = false
+				ui.searchInput.Blur()
+			case key.Matches(msg, ui.keymap.searching.cancel):
+				ui.searchingLogs = false
+				ui.searchInput.Blur()
+				ui.panes.current().clearSearch()
+			case key.Matches(msg, ui.keymap.searching.quit):
+				return ui, quitSeq(ui)
+			default:
+				query := ui.searchInput.Value()
+				ui.searchInput, cmd = ui.searchInput.Update(msg)
+				if query != ui.searchInput.Value() {
+					ui.panes.current().search(ui.searchInput.Value())
+				}
+				return ui, cmd
+			}
+			return ui, nil
 		} else {
 			switch {
+			case key.Matches(msg, ui.keymap.clearSearch) && ui.panes.current().searching():
+				ui.panes.current().clearSearch()
 			case key.Matches(msg, ui.keymap.quit):
 				return ui, quitSeq(ui)
 			case key.Matches(msg, ui.keymap.reload):
@@ -134,10 +202,48 @@ func (ui ui) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				ui.textInput.SetValue(strings.Join(ui.cfg.ExecCommand, " "))
 				ui.textInput.Focus()
 				return ui, tea.Batch(cmds...)
+			case key.Matches(msg, ui.keymap.search):
+				ui.searchingLogs = true
+				ui.searchInput.SetValue("")
+				ui.panes.current().clearSearch()
+				return ui, ui.searchInput.Focus()
+			case key.Matches(msg, ui.keymap.nextMatch):
+				ui.panes.current().nextMatch()
+			case key.Matches(msg, ui.keymap.prevMatch):
+				ui.panes.current().prevMatch()
+			case key.Matches(msg, ui.keymap.filterStream):
+				ui.panes.current().cycleStream()
+			case key.Matches(msg, ui.keymap.follow):
+				ui.panes.current().toggleFollow()
+			case key.Matches(msg, ui.keymap.nextPane):
+				ui.panes.next()
+			case key.Matches(msg, ui.keymap.prevPane):
+				ui.panes.prev()
+			case key.Matches(msg, ui.keymap.selectPane):
+				ui.panes.activate(int(msg.Runes[0] - '1'))
+			case key.Matches(msg, ui.keymap.toggleStats):
+				ui.showStats = !ui.showStats
+				ui.stats = ui.server.Stats()
+				ui.resizeLogs()
+			case key.Matches(msg, ui.keymap.toggleFaults) && ui.stats.FaultsConfigured:
+				if ui.server.ToggleFaults() {
+					ui.logger.Log().Info("Fault injection enabled")
+				} else {
+					ui.logger.Log().Info("Fault injection disabled")
+				}
+				ui.stats = ui.server.Stats()
+			case key.Matches(msg, ui.keymap.top):
+				ui.panes.current().gotoTop()
+			case key.Matches(msg, ui.keymap.bottom):
+				ui.panes.current().gotoBottom()
+			default:
+				cmds = append(cmds, ui.panes.current().update(msg))
 			}
 		}
+	case tea.MouseMsg:
+		cmds = append(cmds, ui.panes.current().update(msg))
 	case tea.WindowSizeMsg:
-		verticalMarginHeight := lipgloss.Height(ui.footerView()) + 1
+		verticalMarginHeight := lipgloss.Height(ui.footerView()) + lipgloss.Height(ui.panes.tabsView()) + 1
 		const horizontalPadding = 2 * 2
 		ui.width = msg.Width
 		ui.viewportWidth = msg.Width - 2
@@ -146,16 +252,38 @@ func (ui ui) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			ui.ready = true
 		}
 		ui.textInput.Width = msg.Width - lipgloss.Width(logo) - 2
+		ui.searchInput.Width = msg.Width - lipgloss.Width(logo) - 2
+		ui.resizeLogs()
+	case statsTickMsg:
+		ui.stats = ui.server.Stats()
+		// The URL might change when the tunnel reconnects.
+		if len(ui.addr) > 0 {
+			ui.addr = ui.server.ListenerAddr()
+		}
+		cmds = append(cmds, tickStats())
 	case spinner.TickMsg:
 		ui.spinner, cmd = ui.spinner.Update(msg)
 		cmds = append(cmds, cmd)
 	case newCommandLogLineMsg:
-		processLine(&ui.viewportContent, styles.CommandLogLine, string(msg))
+		ui.panes.appendCommandOutput(string(msg))
 		cmds = append(cmds, waitForCommandLogs(ui.commandLogsChan))
+	case newCommandErrLogLineMsg:
+		ui.panes.appendCommandErrOutput(string(msg))
+		cmds = append(cmds, waitForCommandErrLogs(ui.commandErrLogsChan))
 	case newLogLineMsg:
-		processLine(&ui.viewportContent, styles.LogLine, string(msg))
+		ui.panes.append(eventsPane, "", styles.LogLine, string(msg))
 		cmds = append(cmds, waitForLogLines(ui.logLinesChan))
+	case newRequestLogLineMsg:
+		ui.panes.appendRequest(string(msg))
+		cmds = append(cmds, waitForRequestLogLines(ui.requestLogsChan))
 	case watcherGotChangesMsg:
+		// The static directory is watched instead, and the command likely
+		// writes to it, so only the browsers are reloaded.
+		if len(ui.cfg.Static) > 0 {
+			ui.server.LiveReload()
+			cmds = append(cmds, listenForChanges(ui.watcher))
+			break
+		}
 		ui.logger.Log().Info("Restarting")
 		cmds = append(cmds,
 			tea.Batch(
@@ -166,6 +294,24 @@ func (ui ui) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				listenForChanges(ui.watcher),
 			),
 		)
+	case adminActionMsg:
+		switch msg.Kind {
+		case admin.Stop:
+			cmds = append(cmds, stopCommand(ui.manager))
+		case admin.Start:
+			if !ui.manager.Status().Running {
+				cmds = append(cmds, startCommand(ui.cfg, ui.manager))
+			}
+		case admin.SetCommand:
+			ui.cfg.ExecCommand = msg.Command
+			fallthrough
+		case admin.Reload:
+			cmds = append(cmds, tea.Sequence(
+				stopCommand(ui.manager),
+				startCommand(ui.cfg, ui.manager),
+			))
+		}
+		cmds = append(cmds, listenForActions(ui.api))
 	case listenerReadyMsg:
 		ui.addr = string(msg)
 		cmds = append(cmds, tea.Batch(
@@ -176,6 +322,8 @@ func (ui ui) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	}
 
 	ui.textInput, cmd = ui.textInput.Update(msg)
+	cmds = append(cmds, cmd)
+	ui.searchInput, cmd = ui.searchInput.Update(msg)
 
 	return ui, tea.Batch(append(cmds, cmd)...)
 }
@@ -186,33 +334,53 @@ func (ui ui) View() string {
 		return "Loading..."
 	}
 
-	logLines := strings.Split(styles.ViewportContent.MaxWidth(ui.viewportWidth-2).Render(strings.Join(ui.viewportContent, "")), "\n")
-	logLines = logLines[max(0, len(logLines)-ui.viewportHeight):]
+	viewport := styles.Viewport.
+		Width(ui.logsWidth()).
+		Height(ui.viewportHeight).
+		Render(ui.panes.current().View())
+	if ui.showStats {
+		viewport = lipgloss.JoinHorizontal(
+			lipgloss.Top,
+			viewport,
+			styles.Viewport.Render(statsView(ui.stats, ui.viewportHeight)),
+		)
+	}
 
 	return fmt.Sprintf(
-		"%s\n%s",
-		styles.Viewport.
-			Width(ui.viewportWidth).
-			Height(ui.viewportHeight).
-			Render(
-				styles.ViewportContent.
-					MaxWidth(ui.viewportWidth-2).
-					Height(ui.viewportHeight).
-					MaxHeight(ui.viewportHeight).
-					Render(strings.Join(logLines, "\n")),
-			),
+		"%s\n%s\n%s",
+		styles.Tabs.Render(ui.panes.tabsView()),
+		viewport,
 		ui.footerView(),
 	)
 }
 
+// Returns the width of the logs viewport, leaving space for the statistics
+// panel if it's shown.
+func (ui ui) logsWidth() int {
+	if ui.showStats {
+		return ui.viewportWidth - statsWidth - 4
+	}
+	return ui.viewportWidth
+}
+
+func (ui *ui) resizeLogs() {
+	ui.panes.setSize(ui.logsWidth()-2, ui.viewportHeight)
+	ui.manager.SetSize(ui.logsWidth()-2, ui.viewportHeight)
+}
+
 func (ui ui) footerView() string {
 	var s string
 	if len(ui.addr) == 0 {
 		s = fmt.Sprintf("%s Establishing connection...", ui.spinner.View())
-	} else if !ui.editingCommand {
-		s = fmt.Sprintf("🌐 %s", styles.Link.Render(ui.addr))
-	} else {
+	} else if ui.editingCommand {
 		s = ui.textInput.View()
+	} else if ui.searchingLogs {
+		s = ui.searchInput.View()
+	} else {
+		s = fmt.Sprintf("🌐 %s", styles.Link.Render(ui.addr))
+	}
+	if status := ui.statusView(); len(status) > 0 && !ui.editingCommand {
+		s = fmt.Sprintf("%s %s", s, status)
 	}
 	s = styles.FooterText.Render(s)
 	hv := ui.helpView()
@@ -231,6 +399,22 @@ func (ui ui) footerView() string {
 	)
 }
 
+func (ui ui) statusView() string {
+	var status []string
+	logs := ui.panes.current()
+	if logs.searching() {
+		current, total := logs.matchPosition()
+		status = append(status, fmt.Sprintf("[%d/%d]", current, total))
+	}
+	if len(logs.stream) > 0 {
+		status = append(status, fmt.Sprintf("[%s]", logs.stream))
+	}
+	if !logs.follow {
+		status = append(status, fmt.Sprintf("[paused %3.f%%]", logs.scrollPercent()*100))
+	}
+	return styles.Status.Render(strings.Join(status, " "))
+}
+
 func (ui ui) helpView() string {
 	if ui.editingCommand {
 		return ui.help.ShortHelpView([]key.Binding{
@@ -238,12 +422,32 @@ func (ui ui) helpView() string {
 			ui.keymap.editing.cancel,
 			ui.keymap.editing.quit,
 		})
-	} else {
+	} else if ui.searchingLogs {
+		return ui.help.ShortHelpView([]key.Binding{
+			ui.keymap.searching.confirm,
+			ui.keymap.searching.cancel,
+			ui.keymap.searching.quit,
+		})
+	} else if ui.panes.current().searching() {
 		return ui.help.ShortHelpView([]key.Binding{
+			ui.keymap.nextMatch,
+			ui.keymap.prevMatch,
+			ui.keymap.clearSearch,
+			ui.keymap.search,
+		})
+	} else {
+		bindings := []key.Binding{
 			ui.keymap.reload,
 			ui.keymap.editCommand,
-			ui.keymap.quit,
-		})
+			ui.keymap.search,
+			ui.keymap.follow,
+			ui.keymap.nextPane,
+			ui.keymap.toggleStats,
+		}
+		if ui.stats.FaultsConfigured {
+			bindings = append(bindings, ui.keymap.toggleFaults)
+		}
+		return ui.help.ShortHelpView(append(bindings, ui.keymap.quit))
 	}
 }
 
@@ -253,16 +457,28 @@ func waitForCommandLogs(sub chan string) tea.Cmd {
 	}
 }
 
+func waitForCommandErrLogs(sub chan string) tea.Cmd {
+	return func() tea.Msg {
+		return newCommandErrLogLineMsg(<-sub)
+	}
+}
+
 func waitForLogLines(sub chan string) tea.Cmd {
 	return func() tea.Msg {
 		return newLogLineMsg(<-sub)
 	}
 }
 
+func waitForRequestLogLines(sub chan string) tea.Cmd {
+	return func() tea.Msg {
+		return newRequestLogLineMsg(<-sub)
+	}
+}
+
 func listenForLogs(sub chan string, reader *bufio.Reader) tea.Cmd {
 	return func() tea.Msg {
 		for {
-			line, err := reader.ReadSlice('\n')
+			line, err := cmd.ReadLine(reader)
 			if err != nil {
 				return nil
 			}
@@ -327,26 +543,54 @@ func watchForChanges(w *cmd.Watcher) tea.Cmd {
 	}
 }
 
+func serveAdmin(api *admin.Server, logger log.Logger) tea.Cmd {
+	return func() tea.Msg {
+		if err := api.Serve(); err != nil {
+			logger.Log().Error("error serving admin API", "error", err)
+		}
+		return nil
+	}
+}
+
+func closeServer(server *server.Server) tea.Cmd {
+	return func() tea.Msg {
+		server.Close()
+		return nil
+	}
+}
+
+func closeAdmin(api *admin.Server) tea.Cmd {
+	return func() tea.Msg {
+		api.Close()
+		return nil
+	}
+}
+
+func listenForActions(api *admin.Server) tea.Cmd {
+	return func() tea.Msg {
+		return adminActionMsg(<-api.Actions())
+	}
+}
+
 func quitSeq(ui ui) tea.Cmd {
 	return tea.Sequence(
 		closeWatcher(ui.watcher),
+		closeAdmin(ui.api),
+		closeServer(ui.server),
 		stopCommand(ui.manager),
 		tea.Quit,
 	)
 }
 
-func processLine(lines *[]string, style lipgloss.Style, line string) {
-	*lines = append(
-		*lines,
-		fmt.Sprintf("%s\n", style.Inline(true).Render(string(line))),
-	)
-	if len(*lines) > maxLines {
-		*lines = (*lines)[len(*lines)-maxLines:]
+func max(a, b int) int {
+	if a > b {
+		return a
 	}
+	return b
 }
 
-func max(a, b int) int {
-	if a > b {
+func min(a, b int) int {
+	if a < b {
 		return a
 	}
 	return b